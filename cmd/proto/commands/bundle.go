@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// BundleExportCmd packs the synced proto files and dependencies into a
+// bundle for machines without network access
+func BundleExportCmd(output string, overrides []proto.Override) {
+	config := loadConfig(overrides)
+
+	if config.SourceKind() == "" {
+		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
+		os.Exit(1)
+	}
+
+	manifest, digest, err := proto.ExportBundle(config, output)
+	if err != nil {
+		printSyncError(err)
+		os.Exit(1)
+	}
+
+	for _, source := range manifest.Sources {
+		name := "proto files"
+		if source.Name != "" {
+			name = "dependency " + source.Name
+		}
+		revision := ""
+		if source.GitHead != "" {
+			revision = " at " + source.GitHead
+		}
+		fmt.Printf("Exported %s: %d file(s) from %s%s\n", name, len(source.Files), source.Location, revision)
+	}
+	fmt.Printf("\nBundle written to %s\n", output)
+	fmt.Printf("sha256: %s\n", digest)
+	fmt.Printf("\nImport it with: proto bundle import %s --sha256 %s\n", output, digest)
+}
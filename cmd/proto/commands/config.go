@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// loadConfig loads the configuration, applies command-line overrides and
+// exits on failure
+func loadConfig(overrides []proto.Override) *proto.Config {
+	config, err := proto.LoadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := config.Apply(overrides); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(config.Migrations()) > 0 {
+		fmt.Printf("Note: %s uses an older format, run 'proto config migrate' to upgrade it\n", config.Path())
+	}
+	return config
+}
+
+// ConfigShowCmd prints the configuration file, or with effective set, the
+// merged configuration and where each value came from
+func ConfigShowCmd(effective bool, overrides []proto.Override) {
+	config := loadConfig(overrides)
+
+	if !effective {
+		data, err := os.ReadFile(config.Path())
+		if err != nil {
+			fmt.Printf("Error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("# %s\n%s", config.Path(), data)
+		return
+	}
+
+	fmt.Printf("# Effective configuration (config file: %s)\n", config.Path())
+	for _, setting := range proto.Settings {
+		value := setting.Get(config)
+		if value != "" {
+			value = strconv.Quote(value)
+		}
+		fmt.Printf("%-20s %-50s # %s\n", setting.Key+":", value, config.Origin(setting.Key))
+	}
+}
+
+// findConfig locates the config file without parsing it, so broken files can
+// still be inspected and repaired
+func findConfig() string {
+	configPath, err := proto.FindConfig()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return configPath
+}
+
+// ConfigGetCmd prints the value of a key as stored in .protorc
+func ConfigGetCmd(key string) {
+	value, ok, err := proto.GetConfigValue(findConfig(), key)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !ok {
+		fmt.Printf("Error: %s is not set\n", key)
+		os.Exit(1)
+	}
+	fmt.Println(value)
+}
+
+// ConfigSetCmd sets a key in .protorc
+func ConfigSetCmd(key, value string) {
+	configPath := findConfig()
+	if err := proto.SetConfigValue(configPath, key, value); err != nil {
+		fmt.Printf("Error setting %s: %v\n", key, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Set %s in %s\n", key, configPath)
+}
+
+// ConfigUnsetCmd removes a key from .protorc
+func ConfigUnsetCmd(key string) {
+	configPath := findConfig()
+	if err := proto.UnsetConfigValue(configPath, key); err != nil {
+		fmt.Printf("Error unsetting %s: %v\n", key, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Unset %s in %s\n", key, configPath)
+}
+
+// ConfigValidateCmd checks .protorc for unknown keys and invalid values
+func ConfigValidateCmd() {
+	configPath := findConfig()
+	if _, err := proto.ReadConfig(configPath); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid\n", configPath)
+}
+
+// ConfigEditCmd opens .protorc in $EDITOR and validates the result
+func ConfigEditCmd() {
+	configPath := findConfig()
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", configPath)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Error running editor: %v\n", err)
+		os.Exit(1)
+	}
+
+	if _, err := proto.ReadConfig(configPath); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("\nRun 'proto config edit' again to fix the file")
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid\n", configPath)
+}
+
+// ConfigMigrateCmd upgrades .protorc on disk to the current format version
+func ConfigMigrateCmd() {
+	configPath := findConfig()
+	applied, err := proto.MigrateConfigFile(configPath)
+	if err != nil {
+		fmt.Printf("Error migrating config: %v\n", err)
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		fmt.Printf("%s is already at version %d\n", configPath, proto.CurrentConfigVersion)
+		return
+	}
+	fmt.Printf("Migrated %s to version %d:\n", configPath, proto.CurrentConfigVersion)
+	for _, description := range applied {
+		fmt.Printf("- %s\n", description)
+	}
+}
+
+// ConfigSchemaCmd prints the JSON Schema for .protorc
+func ConfigSchemaCmd() {
+	fmt.Print(string(proto.Schema))
+}
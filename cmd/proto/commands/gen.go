@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,66 +11,187 @@ import (
 	"github.com/saswatds/proto/pkg/proto"
 )
 
-// GenCmd handles generating SDKs from proto files
-func GenCmd(sdkType string, moduleName string) {
-	config, err := proto.LoadConfig()
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
+// GenOptions holds the optional flags for GenCmd
+type GenOptions struct {
+	AllowToolchainMismatch bool
+	Overrides              []proto.Override
+}
+
+// genError is a generation failure, with advice on fixing it
+type genError struct {
+	message string
+	advice  []string
+}
+
+func (e *genError) Error() string {
+	return e.message
+}
+
+// printGenError prints a generation failure and any advice on fixing it
+func printGenError(err error) {
+	var genErr *genError
+	if !errors.As(err, &genErr) {
+		fmt.Printf("Error: %v\n", err)
+		return
 	}
+	fmt.Println(genErr.message)
+	if len(genErr.advice) > 0 {
+		fmt.Println()
+		for _, line := range genErr.advice {
+			fmt.Println(line)
+		}
+	}
+}
 
-	if config.GitHubURL == "" {
+// GenCmd handles generating SDKs from proto files
+func GenCmd(sdkType string, moduleName string, opts GenOptions) {
+	config := loadConfig(opts.Overrides)
+
+	if config.SourceKind() == "" {
 		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
 		os.Exit(1)
 	}
 
+	protoDir := config.ProtoPath()
+	buildDir := config.BuildPath()
+
 	// Create build directory if it doesn't exist
-	if err := os.MkdirAll(config.BuildDir, 0755); err != nil {
+	if err := os.MkdirAll(buildDir, 0755); err != nil {
 		fmt.Printf("Error creating build directory: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Get all proto files
-	protoFiles, err := filepath.Glob(filepath.Join(config.ProtoDir, "*.proto"))
-	if err != nil {
+	protoFiles := findGenFiles(config)
+	if len(protoFiles) == 0 {
+		fmt.Println("Error: No proto files found in", protoDir)
+		fmt.Println("\nPlease ensure:")
+		fmt.Println("1. You have run 'proto sync' to download proto files")
+		fmt.Println("2. The proto files are in the correct directory:", protoDir)
+		os.Exit(1)
+	}
+
+	// Verify protoc and plugin versions against the pinned toolchain
+	var plan genPlan
+	if _, ok := proto.TargetTools[sdkType]; ok {
+		plan = planGen(config, sdkType, opts.AllowToolchainMismatch)
+	}
+
+	if err := generate(config, sdkType, protoFiles, plan); err != nil {
+		printGenError(err)
+		os.Exit(1)
+	}
+}
+
+// findGenFiles returns the paths of the proto files in ProtoDir, including
+// nested directories, that gen generates code for
+func findGenFiles(config *proto.Config) []string {
+	files, err := proto.GenFiles(config)
+	if err != nil && !os.IsNotExist(err) {
 		fmt.Printf("Error finding proto files: %v\n", err)
 		os.Exit(1)
 	}
+	protoFiles := make([]string, len(files))
+	for i, file := range files {
+		protoFiles[i] = filepath.Join(config.ProtoPath(), filepath.FromSlash(file))
+	}
+	return protoFiles
+}
 
-	if len(protoFiles) == 0 {
-		fmt.Println("Error: No proto files found in", config.ProtoDir)
-		fmt.Println("\nPlease ensure:")
-		fmt.Println("1. You have run 'proto sync' to download proto files")
-		fmt.Println("2. The proto files are in the correct directory:", config.ProtoDir)
+// genPlan is how one SDK type is generated
+type genPlan struct {
+	// python is how protoc is run for Python
+	python proto.PythonGenMode
+	// tools are the tools that run, checked against the pinned toolchain
+	tools []proto.ToolStatus
+}
+
+// planGen picks how sdkType is generated and verifies the tools that involves
+// against the toolchain pinned in .protorc, exiting if it cannot be generated
+// or, unless allowMismatch is set, a tool does not match its pin
+func planGen(config *proto.Config, sdkType string, allowMismatch bool) genPlan {
+	if sdkType != "python" {
+		return genPlan{tools: verifyToolchain(proto.CheckToolchain(config.Toolchain, proto.TargetTools[sdkType], config.Toolchain.LookPath), allowMismatch)}
+	}
+
+	// Check for the gRPC plugin, falling back to grpcio-tools
+	mode, err := proto.SelectPythonGenMode(config.Toolchain.LookPath, func(module string) bool {
+		return exec.Command("python3", "-c", "import "+module).Run() == nil
+	})
+	if err != nil {
+		printGenError(&genError{message: fmt.Sprintf("Error: %v", err), advice: []string{
+			"Please install grpcio-tools using:",
+			"pip install grpcio-tools",
+			"or install protoc and put the gRPC Python plugin on your PATH as protoc-gen-grpc_python",
+		}})
 		os.Exit(1)
 	}
+	fmt.Printf("Using %s: %s\n", mode.Mode, mode.Reason)
+	return genPlan{python: mode, tools: verifyToolchain(proto.CheckPythonToolchain(config.Toolchain, mode, config.Toolchain.LookPath), allowMismatch)}
+}
+
+// generate builds one SDK type from protoFiles into BuildDir as planned,
+// running the target's pre_gen and post_gen hooks around it, and records the
+// toolchain that produced it
+func generate(config *proto.Config, sdkType string, protoFiles []string, plan genPlan) error {
+	buildDir := config.BuildPath()
+
+	if err := proto.RunHooks(config, proto.HookPreGen, proto.HookContext{Target: sdkType, Changed: protoFiles}); err != nil {
+		return err
+	}
+	before, err := proto.ReadFileTimes(buildDir)
+	if err != nil {
+		return err
+	}
+	if err := runProtoc(config, sdkType, protoFiles, plan.python); err != nil {
+		return err
+	}
+	written, err := before.Changed(buildDir)
+	if err != nil {
+		return err
+	}
+
+	// Record the toolchain that produced this output
+	if manifest, err := proto.LoadGenManifest(buildDir); err != nil {
+		fmt.Printf("Warning: Could not load generation manifest: %v\n", err)
+	} else {
+		manifest.RecordToolchain(sdkType, plan.tools)
+		if err := proto.SaveGenManifest(buildDir, manifest); err != nil {
+			fmt.Printf("Warning: Could not save generation manifest: %v\n", err)
+		}
+	}
+
+	return proto.RunHooks(config, proto.HookPostGen, proto.HookContext{Target: sdkType, Changed: written})
+}
+
+// runProtoc generates one SDK type from protoFiles into BuildDir, running
+// protoc for Python as mode selects
+func runProtoc(config *proto.Config, sdkType string, protoFiles []string, mode proto.PythonGenMode) error {
+	buildDir := config.BuildPath()
 
 	// Build proto files
 	switch sdkType {
 	case "go":
 		// Check if protoc-gen-go is installed
-		if _, err := exec.LookPath("protoc-gen-go"); err != nil {
-			fmt.Println("Error: protoc-gen-go not found")
-			fmt.Println("\nPlease install it using:")
-			fmt.Println("go install google.golang.org/protobuf/cmd/protoc-gen-go@latest")
-			os.Exit(1)
+		if _, err := config.Toolchain.LookPath("protoc-gen-go"); err != nil {
+			return &genError{message: "Error: protoc-gen-go not found", advice: []string{
+				"Please install it using:",
+				"go install google.golang.org/protobuf/cmd/protoc-gen-go@latest",
+			}}
 		}
 
 		// Check if protoc-gen-go-grpc is installed
-		if _, err := exec.LookPath("protoc-gen-go-grpc"); err != nil {
-			fmt.Println("Error: protoc-gen-go-grpc not found")
-			fmt.Println("\nPlease install it using:")
-			fmt.Println("go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@latest")
-			os.Exit(1)
+		if _, err := config.Toolchain.LookPath("protoc-gen-go-grpc"); err != nil {
+			return &genError{message: "Error: protoc-gen-go-grpc not found", advice: []string{
+				"Please install it using:",
+				"go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@latest",
+			}}
 		}
 
 		// Read go.mod to get module path
-		goModPath := filepath.Join(".", "go.mod")
+		goModPath := config.ResolvePath("go.mod")
 		goModContent, err := os.ReadFile(goModPath)
 		if err != nil {
-			fmt.Println("Error: go.mod file not found")
-			fmt.Println("Please ensure you're in a Go project directory with a go.mod file")
-			os.Exit(1)
+			return &genError{message: "Error: go.mod file not found\nPlease ensure you're in a Go project directory with a go.mod file"}
 		}
 
 		// Extract module path from go.mod
@@ -83,14 +205,14 @@ func GenCmd(sdkType string, moduleName string) {
 		}
 
 		if modulePath == "" {
-			fmt.Println("Error: Could not find module path in go.mod")
-			os.Exit(1)
+			return &genError{message: "Error: Could not find module path in go.mod"}
 		}
 
 		fmt.Printf("Using module path from go.mod: %s\n", modulePath)
 
 		// Add go_package option to proto files
 		var tmpProtoFiles []string
+		originals := map[string]string{}
 		for _, protoFile := range protoFiles {
 			data, err := os.ReadFile(protoFile)
 			if err != nil {
@@ -129,77 +251,185 @@ func GenCmd(sdkType string, moduleName string) {
 			}
 
 			tmpProtoFiles = append(tmpProtoFiles, tmpFile)
+			originals[tmpFile] = protoFile
 			fmt.Printf("Created temporary proto file: %s\n", tmpFile)
 		}
 
 		// Generate Go SDK
 		args := []string{
-			"--go_out=" + config.BuildDir,
+			"--go_out=" + buildDir,
 			"--go_opt=paths=source_relative",
-			"--go-grpc_out=" + config.BuildDir,
+			"--go-grpc_out=" + buildDir,
 			"--go-grpc_opt=paths=source_relative",
-			"-I", config.ProtoDir,
 		}
-		args = append(args, tmpProtoFiles...)
-		cmd := exec.Command("protoc", args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Error generating Go SDK: %v\n", err)
-			os.Exit(1)
+		args = append(args, includeArgs(config)...)
+		if err := runProtocBatches(config, protocCommand, "Go", args, tmpProtoFiles, originals, nil); err != nil {
+			return err
 		}
-		fmt.Println("Go SDK (with gRPC) generated successfully in", config.BuildDir)
+		fmt.Println("Go SDK (with gRPC) generated successfully in", buildDir)
 
 	case "python":
 		// Check if Python protobuf is installed
 		pythonCmd := exec.Command("python3", "-c", "import google.protobuf")
 		if err := pythonCmd.Run(); err != nil {
-			fmt.Println("Error: Python protobuf package not found")
-			fmt.Println("\nPlease install it using:")
-			fmt.Println("pip install protobuf grpcio grpcio-tools")
-			os.Exit(1)
+			return &genError{message: "Error: Python protobuf package not found", advice: []string{
+				"Please install it using:",
+				"pip install protobuf grpcio grpcio-tools",
+			}}
 		}
 
 		// Check if mypy-protobuf is installed
 		pythonCmd = exec.Command("python3", "-c", "import mypy_protobuf")
 		if err := pythonCmd.Run(); err != nil {
-			fmt.Println("Error: mypy-protobuf not found")
-			fmt.Println("\nPlease install it using:")
-			fmt.Println("pip install mypy-protobuf")
-			os.Exit(1)
+			return &genError{message: "Error: mypy-protobuf not found", advice: []string{
+				"Please install it using:",
+				"pip install mypy-protobuf",
+			}}
+		}
+
+		command := protocCommand
+		if mode.Mode == proto.PythonModeGrpcTools {
+			command = grpcToolsCommand
+		}
+
+		// In managed mode the modules go under the root package directory
+		outDir := config.PythonOutPath()
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return &genError{message: fmt.Sprintf("Error creating Python package directory: %v", err)}
 		}
 
 		// Generate Python SDK with gRPC
-		for _, protoFile := range protoFiles {
-			args := []string{
-				"--python_out=" + config.BuildDir,
-				"--grpc_python_out=" + config.BuildDir,
-				"--mypy_out=" + config.BuildDir,
-				"-I", config.ProtoDir,
-				protoFile,
-			}
+		args := []string{
+			"--python_out=" + outDir,
+			"--grpc_python_out=" + outDir,
+			"--mypy_out=" + outDir,
+		}
+		if mode.Plugin != "" {
+			args = append(args, "--plugin=protoc-gen-grpc_python="+mode.Plugin)
+		}
+		args = append(args, includeArgs(config)...)
+		fmt.Printf("Generating Python SDK for %d proto files with args: %v\n", len(protoFiles), args)
+		err := runProtocBatches(config, command, "Python", args, protoFiles, nil, []string{
+			"Common issues:",
+			"1. Missing Python protobuf or gRPC packages",
+			"2. Syntax errors in proto file",
+			"3. Invalid import paths",
+		})
+		if err != nil {
+			return err
+		}
+		if err := proto.ScaffoldPython(config); err != nil {
+			return &genError{message: fmt.Sprintf("Error scaffolding Python package %s: %v", config.Python.Package, err)}
+		}
+		fmt.Println("Python SDK (with gRPC) generated successfully in", outDir)
 
-			// Log the args
-			fmt.Println("Generating Python SDK with args:", args)
+	default:
+		return &genError{message: "Error: Unsupported SDK type. Use 'go' or 'python'"}
+	}
+	return nil
+}
 
-			cmd := exec.Command("protoc", args...)
+// verifyToolchain reports the tools that do not match the versions pinned in
+// .protorc and exits if there are any, unless allowMismatch is set
+func verifyToolchain(statuses []proto.ToolStatus, allowMismatch bool) []proto.ToolStatus {
+	var mismatches []proto.ToolStatus
+	for _, status := range statuses {
+		if !status.OK() {
+			mismatches = append(mismatches, status)
+		}
+	}
+	if len(mismatches) == 0 {
+		return statuses
+	}
 
-			// Capture both stdout and stderr
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("Error generating Python SDK for %s:\n", filepath.Base(protoFile))
-				fmt.Println(string(output))
-				fmt.Println("\nCommon issues:")
-				fmt.Println("1. Missing Python protobuf or gRPC packages")
-				fmt.Println("2. Syntax errors in proto file")
-				fmt.Println("3. Invalid import paths")
-				os.Exit(1)
+	if allowMismatch {
+		fmt.Println("Warning: Toolchain does not match the versions pinned in .protorc:")
+	} else {
+		fmt.Println("Error: Toolchain does not match the versions pinned in .protorc:")
+	}
+	for _, status := range mismatches {
+		fmt.Printf("- %v\n", status.Err)
+	}
+	if allowMismatch {
+		fmt.Println("Continuing because --allow-toolchain-mismatch was passed")
+		return statuses
+	}
+	fmt.Println("\nPlease install the pinned versions, or rerun with --allow-toolchain-mismatch")
+	os.Exit(1)
+	return nil
+}
+
+// includeArgs returns the protoc include paths: ProtoDir first, then each
+// synced dependency, which is importable but not generated
+func includeArgs(config *proto.Config) []string {
+	args := []string{"-I", config.ProtoPath()}
+	for _, dir := range config.DepIncludePaths() {
+		args = append(args, "-I", dir)
+	}
+	return args
+}
+
+// runProtocBatches runs protoc, as built by command, with args over files, in
+// as few runs as the command line length limit allows, so files imported by
+// several inputs are only compiled once per run. A failure is reported per
+// file protoc named in its output, using names to map temporary copies back
+// to the originals.
+func runProtocBatches(config *proto.Config, command func(*proto.Config, []string) *exec.Cmd, label string, args, files []string, names map[string]string, advice []string) error {
+	for _, batch := range proto.ChunkFiles(args, files, proto.ProtocArgLimit) {
+		cmd := command(config, append(append([]string(nil), args...), batch...))
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			// protoc only prints warnings when it succeeds
+			os.Stdout.Write(output)
+			continue
+		}
+
+		problems := proto.ParseProtocErrors(string(output), batch)
+		if len(problems) == 0 {
+			return &genError{message: fmt.Sprintf("Error generating %s SDK: %v\n%s", label, err, strings.TrimSpace(string(output))), advice: advice}
+		}
+		failed := map[string]bool{}
+		lines := []string{""}
+		for _, problem := range problems {
+			if original, ok := names[problem.File]; ok {
+				problem.File = original
 			}
+			failed[problem.File] = true
+			lines = append(lines, "  "+problem.String())
 		}
-		fmt.Println("Python SDK (with gRPC) generated successfully in", config.BuildDir)
+		message := fmt.Sprintf("Error generating %s SDK, protoc reported problems in %d file(s):", label, len(failed))
+		return &genError{message: message + strings.Join(lines, "\n"), advice: advice}
+	}
+	return nil
+}
 
-	default:
-		fmt.Println("Error: Unsupported SDK type. Use 'go' or 'python'")
-		os.Exit(1)
+// protocCommand builds a protoc invocation that prefers the managed toolchain
+// over PATH, for protoc itself and for the plugins it launches
+func protocCommand(config *proto.Config, args []string) *exec.Cmd {
+	protoc, err := config.Toolchain.LookPath("protoc")
+	if err != nil {
+		protoc = "protoc"
+	}
+	if include := config.Toolchain.ManagedIncludeDir(); include != "" {
+		args = append([]string{"-I", include}, args...)
+	}
+
+	cmd := exec.Command(protoc, args...)
+	if dirs := config.Toolchain.ManagedBinDirs(); len(dirs) > 0 {
+		path := strings.Join(append(dirs, os.Getenv("PATH")), string(os.PathListSeparator))
+		cmd.Env = append(os.Environ(), "PATH="+path)
+	}
+	return cmd
+}
+
+// grpcToolsCommand builds an invocation of the protoc bundled with
+// grpcio-tools, which adds its own well-known type include path. Managed
+// plugins are still put ahead of PATH.
+func grpcToolsCommand(config *proto.Config, args []string) *exec.Cmd {
+	cmd := exec.Command("python3", append([]string{"-m", "grpc_tools.protoc"}, args...)...)
+	if dirs := config.Toolchain.ManagedBinDirs(); len(dirs) > 0 {
+		path := strings.Join(append(dirs, os.Getenv("PATH")), string(os.PathListSeparator))
+		cmd.Env = append(os.Environ(), "PATH="+path)
 	}
+	return cmd
 }
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// fakeProtoc stands in for protoc: for every input it writes a _pb2.py module
+// importing the one next to it the way protoc does, so the Python output
+// layout and import rewriting can be checked without protoc installed
+const fakeProtoc = `#!/bin/sh
+out=""
+include=""
+files=""
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--version) echo "libprotoc 25.1"; exit 0 ;;
+	--python_out=*) out="${1#--python_out=}" ;;
+	-I) shift; [ -z "$include" ] && include="$1" ;;
+	-*) ;;
+	*) files="$files $1" ;;
+	esac
+	shift
+done
+for file in $files; do
+	rel="${file#$include/}"
+	dir=$(dirname "$rel")
+	mkdir -p "$out/$dir"
+	printf 'from %s import common_pb2 as common__pb2\n' "$(echo "$dir" | tr / .)" > "$out/${rel%.proto}_pb2.py"
+done
+`
+
+// fakeMypy stands in for protoc-gen-mypy, which is only asked its version
+const fakeMypy = "#!/bin/sh\necho 'mypy-protobuf 3.6.0'\n"
+
+// installFakeTools writes tools, as shell scripts, to dir and puts dir first
+// on PATH until the returned function is called
+func installFakeTools(t *testing.T, dir string, tools map[string]string) func() {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create bin dir: %v", err)
+	}
+	for name, script := range tools {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	originalPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+originalPath)
+	return func() { os.Setenv("PATH", originalPath) }
+}
+
+func TestGenPythonNested(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tools are shell scripts")
+	}
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	defer installFakeTools(t, filepath.Join(tempDir, "bin"), map[string]string{
+		"protoc":                 fakeProtoc,
+		"protoc-gen-grpc_python": "#!/bin/sh\nexit 0\n",
+		"protoc-gen-mypy":        fakeMypy,
+		"python3":                "#!/bin/sh\nexit 0\n",
+	})()
+
+	protoDir := filepath.Join(tempDir, "proto")
+	for _, file := range []string{"foo/v1/common.proto", "foo/v1/service.proto", "vendor/google/api/http.proto"} {
+		path := filepath.Join(protoDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("syntax = \"proto3\";\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	config := &proto.Config{
+		ProtoDir:  protoDir,
+		BuildDir:  filepath.Join(tempDir, "gen"),
+		VendorDir: filepath.Join(protoDir, "vendor"),
+		Python:    proto.Python{Package: "ourapi"},
+	}
+
+	files := findGenFiles(config)
+	want := []string{filepath.Join(protoDir, "foo", "v1", "common.proto"), filepath.Join(protoDir, "foo", "v1", "service.proto")}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("findGenFiles() = %v, want %v", files, want)
+	}
+	plan := planGen(config, "python", false)
+	if plan.python.Mode != proto.PythonModeProtoc {
+		t.Errorf("planGen() mode = %+v, want protoc", plan.python)
+	}
+	if err := generate(config, "python", files, plan); err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+
+	pkg := filepath.Join(tempDir, "gen", "ourapi")
+	for _, file := range []string{"__init__.py", "foo/__init__.py", "foo/v1/__init__.py", "foo/v1/common_pb2.py"} {
+		if _, err := os.Stat(filepath.Join(pkg, filepath.FromSlash(file))); err != nil {
+			t.Errorf("generate() did not create ourapi/%s: %v", file, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(pkg, "foo", "v1", "service_pb2.py"))
+	if err != nil {
+		t.Fatalf("Failed to read generated module: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(data)), "from . import common_pb2 as common__pb2"; got != want {
+		t.Errorf("Generated import = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(pkg, "vendor")); !os.IsNotExist(err) {
+		t.Error("generate() generated code for the vendored dependency")
+	}
+}
+
+func TestGenPythonGrpcTools(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tools are shell scripts")
+	}
+	for _, plugin := range []string{"protoc-gen-grpc_python", "grpc_python_plugin"} {
+		if _, err := exec.LookPath(plugin); err == nil {
+			t.Skipf("%s is installed, so grpcio-tools would not be used", plugin)
+		}
+	}
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// python3 runs the fake protoc as grpc_tools.protoc, which reports its
+	// own version
+	bundled := filepath.Join(tempDir, "grpc_tools", "protoc")
+	if err := os.MkdirAll(filepath.Dir(bundled), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(bundled, []byte(fakeProtoc), 0755); err != nil {
+		t.Fatalf("Failed to write bundled protoc: %v", err)
+	}
+	python := fmt.Sprintf(`#!/bin/sh
+if [ "$1" = "-m" ] && [ "$2" = "grpc_tools.protoc" ]; then
+	shift 2
+	[ "$1" = "--version" ] && { echo "libprotoc 27.2"; exit 0; }
+	exec %s "$@"
+fi
+exit 0
+`, bundled)
+	defer installFakeTools(t, filepath.Join(tempDir, "bin"), map[string]string{
+		"protoc-gen-mypy": fakeMypy,
+		"python3":         python,
+	})()
+
+	protoDir := filepath.Join(tempDir, "proto")
+	if err := os.MkdirAll(protoDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(protoDir, "common.proto"), []byte("syntax = \"proto3\";\n"), 0644); err != nil {
+		t.Fatalf("Failed to write proto: %v", err)
+	}
+	// The gRPC plugin pin does not apply to the plugin built into
+	// grpcio-tools, and the protoc pin applies to its bundled protoc
+	config := &proto.Config{
+		ProtoDir: protoDir,
+		BuildDir: filepath.Join(tempDir, "gen"),
+		Toolchain: proto.Toolchain{
+			Protoc:  ">=27 <28",
+			Plugins: map[string]string{"protoc-gen-grpc_python": ">=1.60"},
+		},
+	}
+
+	plan := planGen(config, "python", false)
+	if plan.python.Mode != proto.PythonModeGrpcTools {
+		t.Fatalf("planGen() mode = %+v, want grpc_tools", plan.python)
+	}
+	if err := generate(config, "python", findGenFiles(config), plan); err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "gen", "common_pb2.py")); err != nil {
+		t.Errorf("generate() did not run the bundled protoc: %v", err)
+	}
+
+	manifest, err := proto.LoadGenManifest(config.BuildPath())
+	if err != nil {
+		t.Fatalf("LoadGenManifest() error = %v", err)
+	}
+	want := map[string]string{"protoc": "27.2", "protoc-gen-mypy": "3.6.0"}
+	if got := manifest.Targets["python"].Toolchain; !reflect.DeepEqual(got, want) {
+		t.Errorf("Recorded toolchain = %v, want %v", got, want)
+	}
+}
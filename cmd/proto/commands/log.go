@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// LogCmd prints the upstream changes between since, or the previously
+// synced commit, and the synced commit
+func LogCmd(since string, overrides []proto.Override) {
+	config := loadConfig(overrides)
+
+	if config.SourceKind() == "" {
+		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
+		os.Exit(1)
+	}
+
+	changelog, err := proto.Log(config, since)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(changelog.Markdown())
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// Exit codes of StatusCmd. Errors, including a source that could not be
+// checked, exit with 1.
+const (
+	StatusUpToDate = 0
+	StatusOutdated = 2
+	StatusDirty    = 3
+)
+
+// StatusCmd reports whether the synced files and generated code are current,
+// exiting with 1 if a source could not be checked, StatusDirty if synced
+// files were edited, StatusOutdated if a sync or gen is needed, and
+// StatusUpToDate otherwise
+func StatusCmd(offline bool, overrides []proto.Override) {
+	config := loadConfig(overrides)
+
+	if config.SourceKind() == "" {
+		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
+		os.Exit(1)
+	}
+
+	report, err := proto.Status(config, proto.StatusOptions{Offline: offline})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Sources:")
+	for _, source := range report.Sources {
+		printSourceStatus(source)
+	}
+
+	fmt.Println("\nLocal changes:")
+	if len(report.LocalChanges) == 0 {
+		fmt.Println("  none")
+	}
+	for _, change := range report.LocalChanges {
+		fmt.Printf("  %-10s %s\n", change.Status+":", change.File)
+	}
+
+	fmt.Printf("\nGenerated code in %s:\n", report.Build.Dir)
+	switch {
+	case report.Build.GeneratedAt.IsZero():
+		fmt.Println("  never generated, run 'proto gen'")
+	case len(report.Build.Newer) > 0:
+		fmt.Printf("  stale, %d proto files changed since %s, run 'proto gen'\n", len(report.Build.Newer), report.Build.GeneratedAt.Local().Format(time.RFC3339))
+		for _, file := range report.Build.Newer {
+			fmt.Printf("    %s\n", file)
+		}
+	default:
+		fmt.Printf("  up to date (%s, generated %s)\n", strings.Join(report.Build.Targets, ", "), report.Build.GeneratedAt.Local().Format(time.RFC3339))
+	}
+
+	fmt.Println("\nToolchain:")
+	for _, tool := range report.Tools {
+		version := tool.Version
+		switch {
+		case tool.Path == "":
+			version = "not installed"
+		case version == "":
+			version = "unknown version"
+		}
+		line := fmt.Sprintf("  %-24s %s", tool.Name, version)
+		if tool.Constraint != "" {
+			line += fmt.Sprintf(" (pinned %s)", tool.Constraint)
+		}
+		if !tool.OK() {
+			line += " - mismatch"
+		}
+		fmt.Println(line)
+	}
+
+	switch {
+	case report.Failed():
+		os.Exit(1)
+	case report.Dirty():
+		os.Exit(StatusDirty)
+	case report.Outdated():
+		os.Exit(StatusOutdated)
+	}
+}
+
+// printSourceStatus prints one source's sync state against its upstream
+func printSourceStatus(source proto.SourceStatus) {
+	name := "main"
+	if source.Name != "" {
+		name = "dependency " + source.Name
+	}
+	fmt.Printf("  %s (%s %s)\n", name, source.Kind, source.Location)
+
+	if !source.Synced {
+		fmt.Println("    not synced, run 'proto sync'")
+		return
+	}
+	if source.SyncedHead != "" {
+		fmt.Printf("    synced:  %s\n", source.SyncedHead)
+	}
+	if !source.SyncedAt.IsZero() {
+		fmt.Printf("    at:      %s\n", source.SyncedAt.Local().Format(time.RFC3339))
+	}
+	if source.RemoteHead != "" {
+		fmt.Printf("    remote:  %s\n", source.RemoteHead)
+	}
+	switch {
+	case source.Err != nil:
+		fmt.Printf("    could not check for changes: %v\n", source.Err)
+	case source.Changed:
+		fmt.Println("    outdated, run 'proto sync'")
+	case source.Kind == "git" && source.RemoteHead == "":
+		fmt.Println("    remote not checked")
+	case source.Kind == "archive":
+		fmt.Println("    up to date with the configured URL")
+	default:
+		fmt.Println("    up to date")
+	}
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+func TestStatusUnreachableRemote(t *testing.T) {
+	// StatusCmd exits, so it runs in a child process started below
+	if os.Getenv("PROTO_TEST_STATUS") == "1" {
+		StatusCmd(false, nil)
+		return
+	}
+
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, proto.ConfigFileName)
+	content := "version: 1\ngithub_url: file://" + filepath.ToSlash(filepath.Join(tempDir, "missing.git")) + "\nbranch: main\nproto_dir: ./proto\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	config, err := proto.ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	if err := proto.SaveCache(config, proto.SyncState{GitHead: strings.Repeat("a", 40), ContentHash: strings.Repeat("b", 64)}); err != nil {
+		t.Fatalf("SaveCache() error = %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestStatusUnreachableRemote$")
+	cmd.Dir = tempDir
+	cmd.Env = append(os.Environ(), "PROTO_TEST_STATUS=1", "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Errorf("status exit = %v, want 1\n%s", err, output)
+	}
+	if !strings.Contains(string(output), "could not check for changes") {
+		t.Errorf("status output does not report the failed check:\n%s", output)
+	}
+}
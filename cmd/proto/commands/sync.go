@@ -1,228 +1,234 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"github.com/saswatds/proto/pkg/proto"
 )
 
-// SyncCmd handles syncing proto files from the repository
-func SyncCmd() {
-	config, err := proto.LoadConfig()
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
-	}
+// SyncOptions holds the optional flags for SyncCmd
+type SyncOptions struct {
+	DryRun  bool
+	Offline bool
+	Force   bool
+	// Bundle restores the files from a bundle instead of the source
+	Bundle       string
+	BundleSHA256 string
+	Overrides    []proto.Override
+}
+
+// SyncCmd handles syncing proto files from the configured source
+func SyncCmd(opts SyncOptions) {
+	config := loadConfig(opts.Overrides)
 
-	if config.GitHubURL == "" {
+	if config.SourceKind() == "" {
 		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
 		os.Exit(1)
 	}
 
-	// Create temporary directory for cloning
-	tempDir, err := os.MkdirTemp("", "proto-sync-*")
+	result, err := proto.Sync(config, proto.SyncOptions{
+		DryRun:       opts.DryRun,
+		Offline:      opts.Offline,
+		Force:        opts.Force,
+		Bundle:       opts.Bundle,
+		BundleSHA256: opts.BundleSHA256,
+	})
 	if err != nil {
-		fmt.Printf("Error creating temp directory: %v\n", err)
+		printSyncError(err)
 		os.Exit(1)
 	}
-	defer os.RemoveAll(tempDir)
 
-	// Clone repository
-	cloneCmd := exec.Command("git", "clone", "-b", config.Branch, config.GitHubURL, tempDir)
-	if err := cloneCmd.Run(); err != nil {
-		fmt.Printf("Error cloning repository: %v\n", err)
-		fmt.Println("\nCommon issues:")
-		fmt.Println("1. Incorrect repository URL")
-		fmt.Println("2. Private repository (requires authentication)")
-		fmt.Println("3. Incorrect branch name")
-		fmt.Println("4. Network connectivity issues")
-		os.Exit(1)
+	if opts.DryRun {
+		printDryRun(result)
+		for _, dep := range result.Deps {
+			fmt.Printf("\nDependency %s:\n", dep.Name)
+			printDryRun(dep)
+		}
+		return
 	}
 
-	// Get latest commit ID
-	commitCmd := exec.Command("git", "rev-parse", "HEAD")
-	commitCmd.Dir = tempDir
-	commitID, err := commitCmd.Output()
-	if err != nil {
-		fmt.Printf("Error getting commit ID: %v\n", err)
-		os.Exit(1)
+	if result.UpToDate {
+		fmt.Println("Already up to date")
+	} else {
+		fmt.Println("Proto files synced successfully")
+	}
+	printLocalChanges(result.LocalChanges)
+	printRemoved(result)
+	for _, dep := range result.Deps {
+		if dep.UpToDate {
+			fmt.Printf("Dependency %s: already up to date\n", dep.Name)
+		} else {
+			fmt.Printf("Dependency %s: synced %d file(s)\n", dep.Name, len(dep.Files))
+		}
+		printLocalChanges(dep.LocalChanges)
+		printRemoved(dep)
 	}
 
-	// Load cached git head
-	cachedGitHead, err := proto.LoadCache(config)
-	if err != nil {
-		fmt.Printf("Warning: Could not load cache file: %v\n", err)
+	switch config.Changelog {
+	case "", "print":
+		printChangelog("", result.Changelog)
+		for _, dep := range result.Deps {
+			printChangelog(dep.Name, dep.Changelog)
+		}
+	case "file":
+		if result.Changelog != nil && !opts.DryRun {
+			fmt.Printf("Upstream changes added to %s\n", filepath.Join(config.ProtoPath(), proto.ChangesFileName))
+		}
 	}
 
-	// If commit ID hasn't changed, exit
-	if string(commitID) == cachedGitHead {
-		fmt.Println("Already up to date")
+	if len(result.Unresolved) > 0 {
+		fmt.Println("\nWarning: Some imports cannot be resolved, so 'proto gen' will fail:")
+		for _, missing := range result.Unresolved {
+			fmt.Printf("- %s\n", missing)
+		}
+	}
+}
+
+// printChangelog prints the upstream changes a sync brought in, if any
+func printChangelog(dependency string, changelog *proto.Changelog) {
+	if changelog == nil {
 		return
 	}
+	if dependency != "" {
+		fmt.Printf("\nChanges in dependency %s:\n", dependency)
+	}
+	fmt.Printf("\n%s", changelog.Markdown())
+}
 
-	// Create proto directory if it doesn't exist
-	if err := os.MkdirAll(config.ProtoDir, 0755); err != nil {
-		fmt.Printf("Error creating proto directory: %v\n", err)
-		os.Exit(1)
+// printLocalChanges warns about files edited or deleted locally that an
+// up-to-date sync left alone
+func printLocalChanges(files []string) {
+	if len(files) == 0 {
+		return
 	}
+	fmt.Printf("Warning: %d file(s) were changed locally since the last sync and were kept:\n", len(files))
+	for _, file := range files {
+		fmt.Printf("  %s\n", file)
+	}
+	fmt.Println("Run 'proto sync --force' to restore them")
+}
 
-	// Determine the source directory for proto files
-	sourceDir := tempDir
-	if config.RemotePath != "" {
-		// Remove any quotes from the remote path
-		cleanPath := strings.Trim(config.RemotePath, `"'`)
-		sourceDir = filepath.Join(tempDir, cleanPath)
-
-		// Verify the remote path exists
-		if _, err := os.Stat(sourceDir); os.IsNotExist(err) {
-			fmt.Printf("Error: Remote path '%s' does not exist in the repository\n", config.RemotePath)
-			fmt.Println("\nRepository structure:")
-			fmt.Println("----------------------------------------")
-			err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				// Skip the temp directory itself
-				if path == tempDir {
-					return nil
-				}
-				// Skip hidden files and directories
-				if strings.HasPrefix(info.Name(), ".") {
-					if info.IsDir() {
-						return filepath.SkipDir
-					}
-					return nil
-				}
-				// Get relative path from temp directory
-				relPath, err := filepath.Rel(tempDir, path)
-				if err != nil {
-					return err
-				}
-				// Calculate indentation based on depth
-				depth := strings.Count(relPath, string(os.PathSeparator))
-				indent := strings.Repeat("  ", depth)
-
-				if info.IsDir() {
-					fmt.Printf("%s%s/\n", indent, info.Name())
-				} else {
-					fmt.Printf("%s- %s (%d bytes)\n", indent, info.Name(), info.Size())
-				}
-				return nil
-			})
-			if err != nil {
-				fmt.Printf("Error walking directory: %v\n", err)
-			}
-			fmt.Println("----------------------------------------")
-			fmt.Println("\nPlease check if:")
-			fmt.Println("1. The remote_path is correct")
-			fmt.Println("2. The path exists in the repository")
-			fmt.Println("3. The path is properly formatted")
-			os.Exit(1)
+// printRemoved lists the files a sync deleted because they are no longer
+// synced, and warns about the ones it kept because they were edited locally
+func printRemoved(result *proto.SyncResult) {
+	if len(result.Removed) > 0 {
+		fmt.Printf("Removed %d file(s) that are no longer synced:\n", len(result.Removed))
+		for _, file := range result.Removed {
+			fmt.Printf("  %s\n", file)
 		}
 	}
+	if len(result.Orphaned) > 0 {
+		fmt.Printf("Warning: %d file(s) are no longer synced but were changed locally and were kept:\n", len(result.Orphaned))
+		for _, file := range result.Orphaned {
+			fmt.Printf("  %s\n", file)
+		}
+		fmt.Println("Run 'proto sync --force' to remove them")
+	}
+}
 
-	// Find all proto files in the source directory and its subdirectories
-	var protoFiles []string
-	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// printDryRun prints what each pattern matched and which files would be
+// synced
+func printDryRun(result *proto.SyncResult) {
+	for _, match := range result.Matches {
+		fmt.Printf("%s %s: %d file(s)\n", match.Kind, match.Pattern, len(match.Files))
+		for _, file := range match.Files {
+			fmt.Printf("  %s\n", file)
 		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".proto") {
-			protoFiles = append(protoFiles, path)
+	}
+	if len(result.Matches) > 0 {
+		fmt.Println()
+	}
+
+	if result.UpToDate {
+		fmt.Printf("Already up to date (%d file(s))\n", len(result.Files))
+		return
+	}
+	fmt.Printf("Would sync %d file(s):\n", len(result.Files))
+	for _, file := range result.Files {
+		fmt.Printf("  %s\n", file)
+	}
+	if len(result.LocalChanges) > 0 {
+		fmt.Printf("Would refuse to overwrite %d file(s) changed locally:\n", len(result.LocalChanges))
+		for _, file := range result.LocalChanges {
+			fmt.Printf("  %s\n", file)
+		}
+		fmt.Println("Run 'proto sync --force' to overwrite them")
+	}
+	if len(result.Removed) > 0 {
+		fmt.Printf("Would remove %d file(s):\n", len(result.Removed))
+		for _, file := range result.Removed {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	if len(result.Orphaned) > 0 {
+		fmt.Printf("Would keep %d file(s) that are no longer synced but were changed locally:\n", len(result.Orphaned))
+		for _, file := range result.Orphaned {
+			fmt.Printf("  %s\n", file)
 		}
-		return nil
-	})
-	if err != nil {
-		fmt.Printf("Error searching for proto files: %v\n", err)
-		os.Exit(1)
 	}
+}
 
-	if len(protoFiles) == 0 {
-		fmt.Printf("No proto files found in %s\n", sourceDir)
+// printSyncError prints a sync failure along with hints for fixing it
+func printSyncError(err error) {
+	var cloneErr *proto.CloneError
+	var missingErr *proto.MissingPathError
+	var noFilesErr *proto.NoProtoFilesError
+	var bundleErr *proto.BundleError
+	var changesErr *proto.LocalChangesError
+	var sigErr *proto.SignatureError
+
+	switch {
+	case errors.As(err, &cloneErr):
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("\nCommon issues:")
+		fmt.Println("1. Incorrect repository URL")
+		fmt.Println("2. Private repository: configure auth.ssh_key, auth.token_env or auth.netrc in .protorc")
+		fmt.Println("3. Incorrect branch name")
+		fmt.Println("4. Network connectivity issues")
+	case errors.As(err, &missingErr):
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("\nSource structure:")
+		fmt.Println("----------------------------------------")
+		fmt.Print(missingErr.Tree)
+		fmt.Println("----------------------------------------")
+		fmt.Println("\nPlease check if:")
+		fmt.Printf("1. The %s is correct\n", missingErr.Key)
+		fmt.Println("2. The path exists in the source")
+		fmt.Println("3. The path is properly formatted")
+	case errors.As(err, &noFilesErr):
+		fmt.Printf("No proto files found in %s\n", noFilesErr.Dir)
 		fmt.Println("\nDirectory structure:")
 		fmt.Println("----------------------------------------")
-		err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			// Skip the source directory itself
-			if path == sourceDir {
-				return nil
-			}
-			// Skip hidden files and directories
-			if strings.HasPrefix(info.Name(), ".") {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			// Get relative path from source directory
-			relPath, err := filepath.Rel(sourceDir, path)
-			if err != nil {
-				return err
-			}
-			// Calculate indentation based on depth
-			depth := strings.Count(relPath, string(os.PathSeparator))
-			indent := strings.Repeat("  ", depth)
-
-			if info.IsDir() {
-				fmt.Printf("%s%s/\n", indent, info.Name())
-			} else {
-				fmt.Printf("%s- %s (%d bytes)\n", indent, info.Name(), info.Size())
-			}
-			return nil
-		})
-		if err != nil {
-			fmt.Printf("Error walking directory: %v\n", err)
-		}
+		fmt.Print(noFilesErr.Tree)
 		fmt.Println("----------------------------------------")
 		fmt.Println("\nPlease check if:")
 		fmt.Println("1. The remote_path is correct")
-		fmt.Println("2. The repository contains .proto files")
+		fmt.Println("2. The source contains .proto files")
 		fmt.Println("3. The files are in the expected location")
-		os.Exit(1)
-	}
-
-	// Copy proto files to the proto directory
-	for _, protoFile := range protoFiles {
-		// Get relative path from source directory
-		relPath, err := filepath.Rel(sourceDir, protoFile)
-		if err != nil {
-			fmt.Printf("Error getting relative path: %v\n", err)
-			continue
-		}
-
-		// Create destination path
-		destPath := filepath.Join(config.ProtoDir, relPath)
-
-		// Create parent directory if it doesn't exist
-		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			fmt.Printf("Error creating directory for %s: %v\n", relPath, err)
-			continue
-		}
-
-		// Read and copy the file
-		data, err := os.ReadFile(protoFile)
-		if err != nil {
-			fmt.Printf("Error reading proto file %s: %v\n", relPath, err)
-			continue
-		}
-
-		if err := os.WriteFile(destPath, data, 0644); err != nil {
-			fmt.Printf("Error writing proto file %s: %v\n", relPath, err)
-			continue
+		fmt.Println("4. The include and exclude patterns select any files")
+	case errors.As(err, &sigErr):
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("\nNothing was synced. Please check if:")
+		fmt.Println("1. The upstream commit is signed")
+		fmt.Println("2. The signing key is listed in allowed_signers, or in your GPG keyring")
+		fmt.Println("3. The upstream branch was not tampered with")
+	case errors.As(err, &changesErr):
+		fmt.Printf("Error: %d file(s) in %s were modified locally:\n", len(changesErr.Files), changesErr.Dir)
+		for _, file := range changesErr.Files {
+			fmt.Printf("  %s\n", file)
 		}
+		fmt.Println("\nNothing was overwritten. Move the changes upstream, or run with --force to discard them.")
+		fmt.Println("Run 'proto verify' to list every local change.")
+	case errors.As(err, &bundleErr):
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("\nNothing was changed. Please check if:")
+		fmt.Println("1. The bundle was copied completely")
+		fmt.Println("2. The bundle was exported with the same .protorc")
+		fmt.Println("3. The bundle has not been modified since it was exported")
+	default:
+		fmt.Printf("Error: %v\n", err)
 	}
-
-	// Update git head in cache
-	if err := proto.SaveCache(config, string(commitID)); err != nil {
-		fmt.Printf("Error updating cache: %v\n", err)
-		os.Exit(1)
-	}
-
-	fmt.Println("Proto files synced successfully")
 }
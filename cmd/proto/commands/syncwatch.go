@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// SyncWatchOptions holds the flags for SyncWatchCmd
+type SyncWatchOptions struct {
+	Interval time.Duration
+	Force    bool
+	// Gen lists the SDK types to generate after each sync that changes files
+	Gen       []string
+	Overrides []proto.Override
+}
+
+// SyncWatchCmd polls the configured sources and syncs whenever they change,
+// optionally generating code afterwards, until interrupted or sent SIGTERM.
+// Each poll is logged to standard error as a JSON event.
+func SyncWatchCmd(opts SyncWatchOptions) {
+	config := loadConfig(opts.Overrides)
+
+	if config.SourceKind() == "" {
+		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
+		os.Exit(1)
+	}
+	if opts.Interval <= 0 {
+		fmt.Println("Error: --interval must be positive")
+		os.Exit(1)
+	}
+	for _, target := range opts.Gen {
+		if _, ok := proto.TargetTools[target]; !ok {
+			fmt.Printf("Error: Unsupported SDK type %q. Use 'go' or 'python'\n", target)
+			os.Exit(1)
+		}
+	}
+
+	plans := map[string]genPlan{}
+	for _, target := range opts.Gen {
+		plans[target] = planGen(config, target, false)
+	}
+	var afterSync func(*proto.SyncResult) error
+	if len(opts.Gen) > 0 {
+		afterSync = func(*proto.SyncResult) error {
+			if err := os.MkdirAll(config.BuildPath(), 0755); err != nil {
+				return fmt.Errorf("error creating build directory: %v", err)
+			}
+			files := findGenFiles(config)
+			var errs []error
+			for _, target := range opts.Gen {
+				if err := generate(config, target, files, plans[target]); err != nil {
+					errs = append(errs, fmt.Errorf("gen %s: %w", target, err))
+				}
+			}
+			return errors.Join(errs...)
+		}
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("watching", "interval", opts.Interval.String(), "gen", opts.Gen)
+	err := proto.WatchSync(ctx, config, proto.SyncWatchOptions{
+		Interval:  opts.Interval,
+		Force:     opts.Force,
+		AfterSync: afterSync,
+		Log: func(event proto.SyncEvent) {
+			attrs := []any{
+				"cycle", event.Cycle,
+				"status", event.Status,
+				"heads", event.Heads,
+				"changed", event.Changed,
+				"generated", event.Generated,
+				"duration", event.Duration.String(),
+				"next_poll", event.NextPoll.String(),
+			}
+			if event.Err != nil {
+				attrs = append(attrs, "error", event.Err.Error(), "failures", event.Failures)
+				logger.Error("sync", attrs...)
+				return
+			}
+			logger.Info("sync", attrs...)
+		},
+	})
+	if err != nil {
+		logger.Error("stopped", "error", err.Error())
+		os.Exit(1)
+	}
+	logger.Info("stopped")
+}
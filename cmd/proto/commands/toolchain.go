@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// ToolchainInstallCmd installs pinned protoc and plugin versions into the
+// managed toolchain directory. Each entry in tools is either a tool name, whose
+// version is taken from .protorc, or tool@version.
+func ToolchainInstallCmd(tools []string, mirror, archive string) {
+	config, err := proto.LoadConfig()
+	if err != nil && len(tools) == 0 {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if config == nil {
+		config = &proto.Config{}
+	}
+
+	if len(tools) == 0 {
+		tools = config.Toolchain.Pinned()
+		if len(tools) == 0 {
+			fmt.Println("Error: No toolchain versions are pinned in .protorc")
+			os.Exit(1)
+		}
+	}
+	if archive != "" && len(tools) != 1 {
+		fmt.Println("Error: --archive installs a single tool, please name exactly one")
+		os.Exit(1)
+	}
+	if mirror == "" {
+		mirror = config.Toolchain.Mirror
+	}
+	if archive == "" && mirror == "" {
+		fmt.Println("Error: No toolchain mirror configured")
+		fmt.Println("\nPlease either:")
+		fmt.Println("1. Set toolchain.mirror in .protorc")
+		fmt.Println("2. Pass --mirror <url-or-directory>")
+		fmt.Println("3. Pass --archive <file> for a single tool")
+		os.Exit(1)
+	}
+
+	for _, tool := range tools {
+		name, version, found := strings.Cut(tool, "@")
+		if !config.Toolchain.KnownTool(name) {
+			fmt.Printf("Error: unknown tool %q, expected protoc, a protoc plugin used by gen, or a tool pinned in .protorc\n", name)
+			os.Exit(1)
+		}
+		if found {
+			exact, ok := proto.ExactVersion(version)
+			if !ok {
+				fmt.Printf("Error: %q is not an exact version for %s\n", version, name)
+				os.Exit(1)
+			}
+			version = exact
+		} else {
+			constraint := config.Toolchain.Constraint(name)
+			var ok bool
+			if version, ok = proto.ExactVersion(constraint); !ok {
+				if constraint == "" {
+					fmt.Printf("Error: %s is not pinned in .protorc, use %s@<version>\n", name, name)
+				} else {
+					fmt.Printf("Error: %s is pinned to %q, which is not an exact version\n", name, constraint)
+				}
+				os.Exit(1)
+			}
+		}
+
+		if _, ok := proto.ManagedToolPath(name, version); ok && archive == "" {
+			fmt.Printf("%s %s is already installed\n", name, version)
+			continue
+		}
+
+		var dir string
+		if archive != "" {
+			dir, err = proto.InstallTool(name, version, archive)
+		} else {
+			dir, err = proto.InstallFromMirror(name, version, mirror)
+		}
+		if err != nil {
+			fmt.Printf("Error installing %s %s: %v\n", name, version, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Installed %s %s in %s\n", name, version, dir)
+	}
+}
+
+// ToolchainListCmd lists the tool versions in the managed toolchain directory
+func ToolchainListCmd() {
+	installed, err := proto.ListInstalledTools()
+	if err != nil {
+		fmt.Printf("Error listing toolchain: %v\n", err)
+		os.Exit(1)
+	}
+	if len(installed) == 0 {
+		fmt.Println("No tools installed")
+		return
+	}
+
+	// Pins are optional here, the list is useful outside a project too
+	var toolchain proto.Toolchain
+	if config, err := proto.LoadConfig(); err == nil {
+		toolchain = config.Toolchain
+	}
+
+	for _, tool := range installed {
+		marker := " "
+		if version, ok := proto.ExactVersion(toolchain.Constraint(tool.Name)); ok && version == tool.Version {
+			marker = "*"
+		}
+		fmt.Printf("%s %-24s %-10s %s\n", marker, tool.Name, tool.Version, tool.Dir)
+	}
+}
+
+// ToolchainPruneCmd removes installed tool versions that do not satisfy the
+// constraints pinned in .protorc, or every installed version when all is set
+func ToolchainPruneCmd(all bool) {
+	var toolchain proto.Toolchain
+	if !all {
+		config, err := proto.LoadConfig()
+		if err != nil {
+			fmt.Printf("Error loading config: %v\n", err)
+			fmt.Println("Use --all to remove every installed version")
+			os.Exit(1)
+		}
+		toolchain = config.Toolchain
+	}
+
+	installed, err := proto.ListInstalledTools()
+	if err != nil {
+		fmt.Printf("Error listing toolchain: %v\n", err)
+		os.Exit(1)
+	}
+
+	removed := 0
+	for _, tool := range installed {
+		if toolchain.Keeps(tool) {
+			continue
+		}
+		if err := proto.RemoveInstalledTool(tool); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %s %s\n", tool.Name, tool.Version)
+		removed++
+	}
+	fmt.Printf("Pruned %d tool version(s)\n", removed)
+}
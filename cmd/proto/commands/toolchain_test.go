@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+func TestGenUsesPrunedRange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tools are shell scripts")
+	}
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	// protoc on PATH is outside the range, so gen only passes the pin check
+	// if it runs a managed version
+	defer installFakeTools(t, filepath.Join(tempDir, "bin"), map[string]string{
+		"protoc":             "#!/bin/sh\necho 'libprotoc 24.4'\n",
+		"protoc-gen-go":      "#!/bin/sh\necho 'protoc-gen-go v1.34.2'\n",
+		"protoc-gen-go-grpc": "#!/bin/sh\necho 'protoc-gen-go-grpc 1.3.0'\n",
+	})()
+	for _, version := range []string{"25.1", "25.9", "25.10", "26.0"} {
+		dir := filepath.Join(tempDir, "cache", "toolchain", "protoc", version, "bin")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "protoc"), []byte("#!/bin/sh\necho 'libprotoc "+version+"'\n"), 0755); err != nil {
+			t.Fatalf("Failed to write protoc %s: %v", version, err)
+		}
+	}
+
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project dir: %v", err)
+	}
+	content := "version: 1\ngithub_url: https://github.com/example/protos.git\nproto_dir: ./proto\ntoolchain:\n  protoc: \">=25.5 <26\"\n"
+	if err := os.WriteFile(filepath.Join(projectDir, proto.ConfigFileName), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	ToolchainPruneCmd(false)
+	installed, err := proto.ListInstalledTools()
+	if err != nil {
+		t.Fatalf("ListInstalledTools() error = %v", err)
+	}
+	var kept []string
+	for _, tool := range installed {
+		kept = append(kept, tool.Version)
+	}
+	if want := []string{"25.9", "25.10"}; !reflect.DeepEqual(kept, want) {
+		t.Fatalf("prune kept %v, want %v", kept, want)
+	}
+
+	config, err := proto.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	want := filepath.Join(tempDir, "cache", "toolchain", "protoc", "25.10", "bin", "protoc")
+	plan := planGen(config, "go", false)
+	if plan.tools[0].Name != "protoc" || plan.tools[0].Path != want || plan.tools[0].Version != "25.10" {
+		t.Errorf("gen runs protoc %s at %s, want 25.10 at %s", plan.tools[0].Version, plan.tools[0].Path, want)
+	}
+	if dirs := config.Toolchain.ManagedBinDirs(); !reflect.DeepEqual(dirs, []string{filepath.Dir(want)}) {
+		t.Errorf("ManagedBinDirs() = %v, want %v", dirs, []string{filepath.Dir(want)})
+	}
+}
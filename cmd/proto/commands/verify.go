@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// WhichCmd prints where a synced file came from
+func WhichCmd(file string, overrides []proto.Override) {
+	config := loadConfig(overrides)
+
+	entry, err := proto.Which(config, file)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(file)
+	fmt.Printf("  source:    %s\n", entry.Source)
+	if entry.Commit != "" {
+		fmt.Printf("  commit:    %s\n", entry.Commit)
+	}
+	fmt.Printf("  path:      %s\n", entry.Path)
+	fmt.Printf("  sha256:    %s\n", entry.SHA256)
+	fmt.Printf("  synced at: %s\n", entry.SyncedAt.Local().Format(time.RFC3339))
+}
+
+// VerifyCmd checks the synced files against their provenance manifests and
+// exits non-zero if any were changed locally
+func VerifyCmd(overrides []proto.Override) {
+	config := loadConfig(overrides)
+
+	if config.SourceKind() == "" {
+		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
+		os.Exit(1)
+	}
+
+	changes, err := proto.Verify(config)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(changes) == 0 {
+		fmt.Println("All synced files match their manifest")
+		return
+	}
+
+	fmt.Println("Synced files have changed since the last sync:")
+	for _, change := range changes {
+		fmt.Printf("  %-10s %s\n", change.Status+":", change.File)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/saswatds/proto/pkg/proto"
+)
+
+// GenWatchCmd generates every target, then watches ProtoDir, the vendored
+// dependencies and local sources, and regenerates the files affected by each
+// change until interrupted. Changed local sources are synced first. Failures
+// are printed and watching continues.
+func GenWatchCmd(targets []string, poll bool, opts GenOptions) {
+	config := loadConfig(opts.Overrides)
+
+	if config.SourceKind() == "" {
+		fmt.Println("Error: Configuration not initialized. Run 'proto init' first")
+		os.Exit(1)
+	}
+	for _, target := range targets {
+		if _, ok := proto.TargetTools[target]; !ok {
+			fmt.Printf("Error: Unsupported SDK type %q. Use 'go' or 'python'\n", target)
+			os.Exit(1)
+		}
+	}
+	if err := os.MkdirAll(config.BuildPath(), 0755); err != nil {
+		fmt.Printf("Error creating build directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	plans := map[string]genPlan{}
+	for _, target := range targets {
+		plans[target] = planGen(config, target, opts.AllowToolchainMismatch)
+	}
+
+	watcher, err := proto.NewWatcher(proto.WatchDirs(config), proto.WatchOptions{Poll: poll})
+	if err != nil {
+		fmt.Printf("Error watching proto files: %v\n", err)
+		os.Exit(1)
+	}
+	defer watcher.Close()
+
+	// Generate everything once, so the build directory starts out current
+	if files := findGenFiles(config); len(files) > 0 {
+		regenerate(config, targets, files, plans)
+	} else {
+		fmt.Println("No proto files found in", config.ProtoPath(), "yet")
+	}
+
+	mode := "filesystem notifications"
+	if watcher.Polling() {
+		mode = "polling"
+	}
+	fmt.Printf("\nWatching %s for changes using %s. Press Ctrl+C to stop.\n", config.ProtoPath(), mode)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		paths, err := watcher.Next(ctx)
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\nStopped watching")
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error watching proto files: %v\n", err)
+			os.Exit(1)
+		}
+
+		imports, sourceChanged := proto.ClassifyChanges(config, paths)
+		if sourceChanged {
+			// The synced files show up as changes in the next round
+			fmt.Printf("\n[%s] Local source changed, syncing\n", time.Now().Format("15:04:05"))
+			if _, err := proto.Sync(config, proto.SyncOptions{Offline: true}); err != nil {
+				printSyncError(err)
+			}
+		}
+		if len(imports) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n[%s] Changed: %s\n", time.Now().Format("15:04:05"), strings.Join(imports, ", "))
+		names, err := proto.GenFiles(config)
+		if err != nil {
+			fmt.Printf("Error finding proto files: %v\n", err)
+			continue
+		}
+		affected, err := proto.AffectedFiles(config, names, imports)
+		if err != nil {
+			fmt.Printf("Error finding affected files: %v\n", err)
+			continue
+		}
+		if len(affected) == 0 {
+			fmt.Println("No generated files are affected")
+			continue
+		}
+		var affectedPaths []string
+		for _, name := range affected {
+			affectedPaths = append(affectedPaths, filepath.Join(config.ProtoPath(), filepath.FromSlash(name)))
+		}
+		fmt.Printf("Regenerating %s\n", strings.Join(affected, ", "))
+		regenerate(config, targets, affectedPaths, plans)
+	}
+}
+
+// regenerate generates files for each target, printing failures instead of
+// exiting
+func regenerate(config *proto.Config, targets, files []string, plans map[string]genPlan) {
+	for _, target := range targets {
+		if err := generate(config, target, files, plans[target]); err != nil {
+			printGenError(err)
+		}
+	}
+}
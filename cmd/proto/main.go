@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/saswatds/proto/cmd/proto/commands"
+	"github.com/saswatds/proto/pkg/proto"
 	"github.com/spf13/cobra"
 )
 
@@ -16,54 +19,462 @@ var rootCmd = &cobra.Command{
 
 var (
 	githubURL  string
+	sourcePath string
+	archive    proto.ArchiveSource
 	branch     string
 	remotePath string
 	protoDir   string
 	buildDir   string
+
+	allowToolchainMismatch bool
+	genWatch               bool
+	genPoll                bool
+
+	syncDryRun  bool
+	syncOffline bool
+	syncForce   bool
+
+	syncWatch    bool
+	syncInterval time.Duration
+	syncGen      []string
+
+	logSince string
+
+	statusOffline bool
+
+	bundlePath   string
+	bundleOutput string
+	bundleSHA256 string
+
+	toolchainMirror  string
+	toolchainArchive string
+	pruneAll         bool
+
+	showEffective bool
 )
 
+// configFlags maps the flags that override .protorc to their config keys.
+// Overrides are layered as .protorc < PROTO_* environment < flags.
+var configFlags = map[string]string{
+	"url":         "github_url",
+	"path":        "path",
+	"branch":      "branch",
+	"remote-path": "remote_path",
+	"proto-dir":   "proto_dir",
+	"build-dir":   "build_dir",
+}
+
+// pathFlags are the config flags naming a path. Like any other command-line
+// path they are relative to the working directory, while the same keys in
+// .protorc are relative to the file.
+var pathFlags = map[string]bool{
+	"path":      true,
+	"proto-dir": true,
+	"build-dir": true,
+}
+
+// addConfigFlags registers override flags for the given config flag names
+func addConfigFlags(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		usage := fmt.Sprintf("Override %s from .protorc", configFlags[name])
+		if pathFlags[name] {
+			usage += " (relative to the working directory)"
+		}
+		cmd.Flags().String(name, "", usage)
+	}
+}
+
+// flagOverrides collects the override flags that were set on cmd. Path flags
+// are made absolute, so they are not resolved against the .protorc directory.
+func flagOverrides(cmd *cobra.Command) []proto.Override {
+	var overrides []proto.Override
+	for name, key := range configFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		value := flag.Value.String()
+		if pathFlags[name] && value != "" && !filepath.IsAbs(value) {
+			if abs, err := filepath.Abs(value); err == nil {
+				value = abs
+			}
+		}
+		overrides = append(overrides, proto.Override{
+			Key:    key,
+			Value:  value,
+			Origin: "flag --" + name,
+		})
+	}
+	return overrides
+}
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize proto configuration",
-	Long:  `Initialize proto configuration with GitHub URL, branch, and proto directory.`,
+	Long:  `Initialize proto configuration with a repository URL, local directory or archive, branch, and proto directory.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if githubURL == "" {
-			fmt.Println("Error: GitHub repository URL is required")
+		if githubURL == "" && sourcePath == "" && archive.URL == "" {
+			fmt.Println("Error: GitHub repository URL (--url), local directory (--path) or archive (--archive) is required")
 			os.Exit(1)
 		}
-		commands.InitCmd(githubURL, branch, remotePath, protoDir, buildDir)
+		// An archive's subpath already selects the proto directory
+		if archive.URL != "" && !cmd.Flags().Changed("remote-path") {
+			remotePath = ""
+		}
+		commands.InitCmd(&proto.Config{
+			GitHubURL:  githubURL,
+			LocalPath:  sourcePath,
+			Archive:    archive,
+			Branch:     branch,
+			RemotePath: remotePath,
+			ProtoDir:   protoDir,
+			BuildDir:   buildDir,
+		})
 	},
 }
 
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Sync proto files from repository",
-	Long:  `Sync proto files from the configured GitHub repository.`,
+	Long: `Sync proto files from the configured repository or local directory.
+
+With --watch, keep running and sync whenever a source changes, checking repositories with
+git ls-remote every --interval, and optionally generate code with --gen afterwards. Each
+poll is logged to standard error as a JSON line. Failed polls are retried with a growing
+delay. SIGTERM or Ctrl+C stops watching once the current poll finishes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if syncWatch {
+			commands.SyncWatchCmd(commands.SyncWatchOptions{
+				Interval:  syncInterval,
+				Force:     syncForce,
+				Gen:       syncGen,
+				Overrides: flagOverrides(cmd),
+			})
+			return
+		}
+		commands.SyncCmd(commands.SyncOptions{
+			DryRun:       syncDryRun,
+			Offline:      syncOffline,
+			Force:        syncForce,
+			Bundle:       bundlePath,
+			BundleSHA256: bundleSHA256,
+			Overrides:    flagOverrides(cmd),
+		})
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the synced files and generated code are current",
+	Long: `Show each source's synced commit next to the remote head, files changed locally since
+the last sync, whether the generated code is older than the proto files, and the toolchain
+versions. Nothing is changed.
+
+Exit status:
+  0  everything is up to date
+  1  an error occurred
+  2  outdated: a source changed upstream, or code needs generating
+  3  dirty: synced files were edited locally`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.StatusCmd(statusOffline, flagOverrides(cmd))
+	},
+}
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show upstream changes to the synced files",
+	Long: `Show the upstream commits that touched the synced files and the messages, fields,
+enums and RPCs they changed, between the previously synced commit, or --since, and the
+synced commit. The cached mirror is used, so no network access is needed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.LogCmd(logSince, flagOverrides(cmd))
+	},
+}
+
+var whichCmd = &cobra.Command{
+	Use:   "which <file>",
+	Short: "Show where a synced file came from",
+	Long: `Show the source, commit, upstream path, sha256 and sync time recorded for a synced
+file. The file may be given relative to the current directory or to the proto directory.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.WhichCmd(args[0], flagOverrides(cmd))
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check synced files for local modifications",
+	Long: `Compare the files in the proto directory and the vendored dependencies against the
+manifest written when they were synced, and list every file modified, deleted or added since.
+Exits with a non-zero status if anything changed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.VerifyCmd(flagOverrides(cmd))
+	},
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Move synced proto files to machines without network access",
+	Long: `Export the synced proto files, their sync state and the dependency protos into a
+single bundle, and import it, pinned by its sha256, on machines that cannot reach the sources.`,
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Pack the synced proto files into a bundle",
+	Long:  `Pack the proto directory, the dependency vendor directories and their sync state into a .tar.gz bundle.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.BundleExportCmd(bundleOutput, flagOverrides(cmd))
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Restore the proto files from a bundle",
+	Long: `Verify a bundle against the sha256 printed by 'proto bundle export' and restore the
+proto files and dependencies it contains. Like a sync, sources whose files have not changed
+are left alone. Same as 'proto sync --from-bundle'.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		commands.SyncCmd()
+		commands.SyncCmd(commands.SyncOptions{
+			Bundle:       args[0],
+			BundleSHA256: bundleSHA256,
+			Force:        syncForce,
+			Overrides:    flagOverrides(cmd),
+		})
 	},
 }
 
 var genCmd = &cobra.Command{
 	Use:   "gen [sdk_type]",
 	Short: "Generate SDK from proto files",
-	Long:  `Generate SDK (Go or Python) from proto files.`,
+	Long: `Generate SDK (Go or Python) from proto files.
+
+With --watch, keep running and regenerate the files affected by every change to the proto
+directory, the vendored dependencies or local sources. Several SDK types may be given.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if genWatch {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := commands.GenOptions{
+			AllowToolchainMismatch: allowToolchainMismatch,
+			Overrides:              flagOverrides(cmd),
+		}
+		if genWatch {
+			commands.GenWatchCmd(args, genPoll, opts)
+			return
+		}
+		commands.GenCmd(args[0], "", opts)
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and edit the proto configuration",
+	Long:  `Inspect, edit and validate the proto configuration stored in .protorc.`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the configuration",
+	Long: `Show the .protorc file. With --effective, show the merged configuration after
+environment variables and flags are applied, and where each value came from.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigShowCmd(showEffective, flagOverrides(cmd))
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a configuration value",
+	Long:  `Print the value of a dotted key, such as toolchain.protoc, as stored in .protorc.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigGetCmd(args[0])
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a configuration value",
+	Long:  `Set a dotted key in .protorc, keeping comments. The file is only written if the result is valid.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigSetCmd(args[0], args[1])
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a configuration value",
+	Long:  `Remove a dotted key from .protorc.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		commands.GenCmd(args[0], "")
+		commands.ConfigUnsetCmd(args[0])
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration",
+	Long:  `Check .protorc for unknown keys and invalid values.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigValidateCmd()
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the configuration",
+	Long:  `Open .protorc in $EDITOR and validate it afterwards.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigEditCmd()
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the configuration format",
+	Long:  `Upgrade .protorc to the current format version, moving legacy keys such as gitHead to where they now belong.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigMigrateCmd()
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for .protorc",
+	Long:  `Print the JSON Schema describing .protorc, for use with editors and linters.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ConfigSchemaCmd()
+	},
+}
+
+var toolchainCmd = &cobra.Command{
+	Use:   "toolchain",
+	Short: "Manage pinned protoc and plugin versions",
+	Long:  `Install, list and prune the protoc and plugin versions kept in the per-user toolchain cache.`,
+}
+
+var toolchainInstallCmd = &cobra.Command{
+	Use:   "install [tool[@version]...]",
+	Short: "Install pinned toolchain versions",
+	Long:  `Install protoc and plugins into the toolchain cache. Without arguments, every exact version pinned in .protorc is installed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ToolchainInstallCmd(args, toolchainMirror, toolchainArchive)
+	},
+}
+
+var toolchainListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List installed toolchain versions",
+	Long:  `List the tool versions in the toolchain cache. Versions pinned in .protorc are marked with *.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ToolchainListCmd()
+	},
+}
+
+var toolchainPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove unpinned toolchain versions",
+	Long:  `Remove tool versions from the toolchain cache that do not satisfy the constraints pinned in .protorc.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commands.ToolchainPruneCmd(pruneAll)
 	},
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&proto.ConfigFile, "config", "", "Path to the .protorc file (overrides discovery and PROTO_CONFIG)")
+
 	initCmd.Flags().StringVar(&githubURL, "url", "", "GitHub repository URL")
+	initCmd.Flags().StringVar(&sourcePath, "path", "", "Local directory to sync from instead of a repository")
+	initCmd.Flags().StringVar(&archive.URL, "archive", "", "URL or path of a .tar.gz or .zip archive to sync from instead of a repository")
+	initCmd.Flags().StringVar(&archive.SHA256, "sha256", "", "Expected sha256 of the --archive")
+	initCmd.Flags().StringVar(&archive.StripPrefix, "strip-prefix", "", "Leading directory to remove from --archive entries")
+	initCmd.Flags().StringVar(&archive.Subpath, "subpath", "", "Directory inside --archive holding the proto files")
 	initCmd.Flags().StringVar(&branch, "branch", "main", "Git branch name")
 	initCmd.Flags().StringVar(&remotePath, "remote-path", "proto", "Path within the repository containing proto files")
 	initCmd.Flags().StringVar(&protoDir, "proto-dir", "./proto", "Directory for synced proto files")
 	initCmd.Flags().StringVar(&buildDir, "build-dir", "./gen", "Directory for generated SDKs")
 
+	addConfigFlags(syncCmd, "url", "path", "branch", "remote-path", "proto-dir")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "List the files each include and exclude pattern matches without syncing")
+	syncCmd.Flags().BoolVar(&syncOffline, "offline", false, "Sync from the cached mirror or archive without contacting the network")
+	syncCmd.Flags().BoolVar(&syncForce, "force", false, "Overwrite files modified locally since the last sync, and restore them even if the source is unchanged")
+	syncCmd.Flags().StringVar(&bundlePath, "from-bundle", "", "Restore the proto files from a bundle written by 'proto bundle export'")
+	syncCmd.Flags().StringVar(&bundleSHA256, "bundle-sha256", "", "Expected sha256 of the --from-bundle file, as printed by 'proto bundle export'")
+	syncCmd.Flags().BoolVar(&syncWatch, "watch", false, "Keep running and sync whenever a source changes")
+	syncCmd.Flags().DurationVar(&syncInterval, "interval", 5*time.Minute, "With --watch, how often to poll the sources")
+	syncCmd.Flags().StringSliceVar(&syncGen, "gen", nil, "With --watch, SDK types to generate after each sync that changes files")
+	syncCmd.MarkFlagsRequiredTogether("from-bundle", "bundle-sha256")
+	syncCmd.MarkFlagsMutuallyExclusive("from-bundle", "offline")
+	syncCmd.MarkFlagsMutuallyExclusive("watch", "dry-run")
+	syncCmd.MarkFlagsMutuallyExclusive("watch", "offline")
+	syncCmd.MarkFlagsMutuallyExclusive("watch", "from-bundle")
+	addConfigFlags(genCmd, "proto-dir", "build-dir")
+	addConfigFlags(configShowCmd, "url", "path", "branch", "remote-path", "proto-dir", "build-dir")
+	configShowCmd.Flags().BoolVar(&showEffective, "effective", false, "Show merged values and where each came from")
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	genCmd.Flags().BoolVar(&genWatch, "watch", false, "Regenerate whenever proto files change")
+	genCmd.Flags().BoolVar(&genPoll, "poll", false, "With --watch, scan for changes instead of using filesystem notifications")
+	genCmd.Flags().BoolVar(&allowToolchainMismatch, "allow-toolchain-mismatch", false, "Generate even if protoc or plugin versions do not match .protorc")
+
+	toolchainInstallCmd.Flags().StringVar(&toolchainMirror, "mirror", "", "Mirror URL or directory to fetch archives from (overrides toolchain.mirror)")
+	toolchainInstallCmd.Flags().StringVar(&toolchainArchive, "archive", "", "Install a single tool from this archive path or URL")
+	toolchainPruneCmd.Flags().BoolVar(&pruneAll, "all", false, "Remove every installed version")
+	toolchainCmd.AddCommand(toolchainInstallCmd)
+	toolchainCmd.AddCommand(toolchainListCmd)
+	toolchainCmd.AddCommand(toolchainPruneCmd)
+
+	statusCmd.Flags().BoolVar(&statusOffline, "offline", false, "Skip asking repositories for their latest commit")
+	addConfigFlags(statusCmd, "proto-dir", "build-dir")
+	logCmd.Flags().StringVar(&logSince, "since", "", "Commit to start from instead of the previously synced one")
+	addConfigFlags(logCmd, "proto-dir")
+	addConfigFlags(whichCmd, "proto-dir")
+	addConfigFlags(verifyCmd, "proto-dir")
+
+	bundleExportCmd.Flags().StringVarP(&bundleOutput, "output", "o", "proto-bundle.tar.gz", "File to write the bundle to")
+	addConfigFlags(bundleExportCmd, "proto-dir")
+	bundleImportCmd.Flags().StringVar(&bundleSHA256, "sha256", "", "Expected sha256 of the bundle, as printed by 'proto bundle export'")
+	bundleImportCmd.MarkFlagRequired("sha256")
+	bundleImportCmd.Flags().BoolVar(&syncForce, "force", false, "Overwrite files modified locally since the last sync")
+	addConfigFlags(bundleImportCmd, "proto-dir")
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(bundleCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(whichCmd)
+	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(genCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(toolchainCmd)
 }
 
 func main() {
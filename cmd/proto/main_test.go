@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/saswatds/proto/pkg/proto"
+	"github.com/spf13/cobra"
 )
 
 func TestMain(m *testing.M) {
@@ -76,18 +79,35 @@ func TestSyncCommand(t *testing.T) {
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
 
-	// Initialize with a test repository
-	os.Args = []string{"proto", "init", "--url", "https://github.com/example/proto", "--branch", "main", "--remote-path", "./protos"}
+	// Sync from a local directory so the test does not need the network
+	upstream := filepath.Join(tempDir, "upstream", "protos")
+	if err := os.MkdirAll(upstream, 0755); err != nil {
+		t.Fatalf("Failed to create upstream dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(upstream, "service.proto"), []byte("syntax = \"proto3\";\n"), 0644); err != nil {
+		t.Fatalf("Failed to write proto file: %v", err)
+	}
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working dir: %v", err)
+	}
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change dir: %v", err)
+	}
+	defer os.Chdir(originalDir)
+
+	os.Args = []string{"proto", "init", "--path", "./upstream", "--remote-path", "./protos", "--proto-dir", "./proto"}
 	main()
 
 	// Test sync command
 	os.Args = []string{"proto", "sync"}
 	main()
 
-	// Check if output directory exists
-	outputDir := filepath.Join(tempDir, "protos")
-	if _, err := os.Stat(outputDir); err != nil {
-		t.Errorf("Output directory not created: %v", err)
+	// Check if the proto file was synced
+	outputFile := filepath.Join(tempDir, "proto", "service.proto")
+	if _, err := os.Stat(outputFile); err != nil {
+		t.Errorf("Proto file not synced: %v", err)
 	}
 }
 
@@ -278,3 +298,54 @@ func TestGenerateSDK(t *testing.T) {
 		})
 	}
 }
+
+func TestFlagOverridesResolvePaths(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	protorc := "github_url: https://github.com/example/proto\nbranch: main\nproto_dir: ./proto\nbuild_dir: ./gen\n"
+	if err := os.WriteFile(filepath.Join(tempDir, ".protorc"), []byte(protorc), 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+	subDir := filepath.Join(tempDir, "sub")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(subDir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(originalDir)
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	// A path flag is relative to where proto runs, not to .protorc
+	cmd := &cobra.Command{}
+	addConfigFlags(cmd, "proto-dir", "branch")
+	cmd.Flags().Set("proto-dir", "./p2")
+	cmd.Flags().Set("branch", "dev")
+	config, err := proto.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if err := config.Apply(flagOverrides(cmd)); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got, want := config.ProtoPath(), filepath.Join(workDir, "p2"); got != want {
+		t.Errorf("ProtoPath() = %q, want %q", got, want)
+	}
+	if config.Branch != "dev" {
+		t.Errorf("Branch = %q, want %q", config.Branch, "dev")
+	}
+	if got := config.BuildPath(); got != filepath.Join("..", "gen") {
+		t.Errorf("BuildPath() = %q, want the .protorc build_dir", got)
+	}
+}
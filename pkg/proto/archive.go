@@ -0,0 +1,330 @@
+package proto
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// downloadTimeout bounds a whole download, so a stalled server fails the
+// command instead of hanging it. It is generous enough for a large archive
+// over a slow link.
+var downloadTimeout = 10 * time.Minute
+
+// DownloadFile copies src to dest. src may be an http(s) URL, a file:// URL
+// or a local path.
+func DownloadFile(src, dest string) error {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		client := &http.Client{Timeout: downloadTimeout}
+		resp, err := client.Get(src)
+		if err != nil {
+			return fmt.Errorf("error downloading %s: %v", src, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("error downloading %s: %s", src, resp.Status)
+		}
+		return writeStream(resp.Body, dest)
+	}
+
+	in, err := os.Open(strings.TrimPrefix(src, "file://"))
+	if err != nil {
+		return fmt.Errorf("error opening %s: %v", src, err)
+	}
+	defer in.Close()
+	return writeStream(in, dest)
+}
+
+func writeStream(r io.Reader, dest string) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", dest, err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing %s: %v", dest, err)
+	}
+	return out.Close()
+}
+
+// ExtractArchive extracts a .tar.gz or .zip archive into dest. The format is
+// detected from the file contents. Entries that would land outside dest are
+// rejected.
+func ExtractArchive(archivePath, dest string) error {
+	return extractArchive(archivePath, dest, nil)
+}
+
+// extractArchive extracts the regular files for which keep returns true, or
+// every file if keep is nil
+func extractArchive(archivePath, dest string, keep func(name string) bool) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening archive: %v", err)
+	}
+	defer f.Close()
+
+	magic, err := bufio.NewReader(f).Peek(4)
+	if err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+		return extractZip(f, info.Size(), dest, keep)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return extractTarGz(f, dest, keep)
+	default:
+		return fmt.Errorf("unsupported archive format: %s", filepath.Base(archivePath))
+	}
+}
+
+// archiveTarget returns the path an archive entry extracts to, or an error if
+// the entry escapes dest
+func archiveTarget(dest, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) {
+		return "", fmt.Errorf("archive entry %q has an absolute path", name)
+	}
+	clean := path.Clean(slashed)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("archive entry %q escapes the destination directory", name)
+	}
+	return filepath.Join(dest, filepath.FromSlash(clean)), nil
+}
+
+func extractTarGz(r io.Reader, dest string, keep func(string) bool) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("error reading gzip stream: %v", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar archive: %v", err)
+		}
+
+		target, err := archiveTarget(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("error creating directory: %v", err)
+			}
+		case tar.TypeReg:
+			if keep != nil && !keep(header.Name) {
+				continue
+			}
+			if err := writeArchiveFile(target, tr, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		default:
+			// Links and special files are never needed and could point
+			// outside the destination, so skip them
+		}
+	}
+}
+
+func extractZip(r io.ReaderAt, size int64, dest string, keep func(string) bool) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("error reading zip archive: %v", err)
+	}
+
+	for _, file := range zr.File {
+		target, err := archiveTarget(dest, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("error creating directory: %v", err)
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() || (keep != nil && !keep(file.Name)) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", file.Name, err)
+		}
+		err = writeArchiveFile(target, rc, file.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeArchiveFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	// Keep the executable bits so extracted tools can be run
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", target, err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing %s: %v", target, err)
+	}
+	return out.Close()
+}
+
+// ArchiveSource is a release archive to sync proto files from
+type ArchiveSource struct {
+	// URL is an http(s) or file:// URL, or a path relative to .protorc
+	URL string `yaml:"url,omitempty"`
+	// SHA256 is the expected hex digest of the archive
+	SHA256 string `yaml:"sha256,omitempty"`
+	// StripPrefix is a leading directory inside the archive to remove, such
+	// as the "name-1.2.3" directory release tarballs usually wrap files in
+	StripPrefix string `yaml:"strip_prefix,omitempty"`
+	// Subpath is the directory, after StripPrefix, holding the proto files
+	Subpath string `yaml:"subpath,omitempty"`
+}
+
+// archiveCacheDir returns the directory extracted archives are cached in
+func archiveCacheDir() (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "archives"), nil
+}
+
+// fetchArchive downloads, verifies and extracts the .proto files of an
+// archive into the per-user cache, and returns the directory selected by
+// StripPrefix and Subpath. Extracted archives are keyed by digest, so an
+// archive is only downloaded once no matter how many projects use it. When
+// offline, only cached archives can be used.
+func fetchArchive(source ArchiveSource, location string, offline bool) (string, error) {
+	digest := strings.ToLower(source.SHA256)
+	cacheDir, err := archiveCacheDir()
+	if err != nil {
+		return "", err
+	}
+	extracted := filepath.Join(cacheDir, digest)
+
+	if _, err := os.Stat(extracted); os.IsNotExist(err) {
+		if offline {
+			return "", fmt.Errorf("archive %s is not cached; run 'proto sync' without --offline first", RedactURL(location))
+		}
+		if err := downloadArchive(location, digest, cacheDir, extracted); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("error reading archive cache: %v", err)
+	}
+
+	root := extracted
+	for _, sub := range []struct{ key, value string }{
+		{"archive.strip_prefix", source.StripPrefix},
+		{"archive.subpath", source.Subpath},
+	} {
+		if sub.value == "" {
+			continue
+		}
+		target, err := archiveTarget(root, sub.value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", sub.key, err)
+		}
+		if info, err := os.Stat(target); err != nil || !info.IsDir() {
+			return "", &MissingPathError{Key: sub.key, Path: sub.value, Tree: describeTree(root)}
+		}
+		root = target
+	}
+	return root, nil
+}
+
+// downloadArchive fetches an archive, checks its digest and extracts its
+// .proto files to extracted. Work happens in a staging directory that is
+// renamed into place, so an interrupted download never leaves a partial
+// cache entry behind.
+func downloadArchive(location, digest, cacheDir, extracted string) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("error creating archive cache: %v", err)
+	}
+	staging, err := os.MkdirTemp(cacheDir, ".download-*")
+	if err != nil {
+		return fmt.Errorf("error creating archive cache: %v", err)
+	}
+	defer os.RemoveAll(staging)
+
+	archivePath := filepath.Join(staging, "archive")
+	if err := DownloadFile(location, archivePath); err != nil {
+		return err
+	}
+	actual, err := fileSHA256(archivePath)
+	if err != nil {
+		return err
+	}
+	if actual != digest {
+		return fmt.Errorf("archive %s has sha256 %s, want %s", RedactURL(location), actual, digest)
+	}
+
+	tree := filepath.Join(staging, "tree")
+	isProto := func(name string) bool { return strings.HasSuffix(name, ".proto") }
+	if err := extractArchive(archivePath, tree, isProto); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tree, 0755); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	if err := os.Rename(tree, extracted); err != nil {
+		// Another sync may have cached the same digest in the meantime
+		if _, statErr := os.Stat(extracted); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("error caching archive: %v", err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex sha256 digest of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %v", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,236 @@
+package proto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Auth configures credentials for private repositories. It only says where
+// secrets can be found, so .protorc never holds a secret itself.
+type Auth struct {
+	// SSHKey is the private key used for ssh:// and git@host: URLs
+	SSHKey string `yaml:"ssh_key,omitempty"`
+	// TokenEnv names the environment variable holding an HTTPS token
+	TokenEnv string `yaml:"token_env,omitempty"`
+	// TokenUser is the username sent with the token, x-access-token by default
+	TokenUser string `yaml:"token_user,omitempty"`
+	// TokenMethod is "helper" (a git credential helper, the default) or
+	// "header" (an http.extraHeader)
+	TokenMethod string `yaml:"token_method,omitempty"`
+	// Netrc is a .netrc file to read HTTPS credentials from
+	Netrc string `yaml:"netrc,omitempty"`
+}
+
+// credentialHelper answers git's "get" requests from the environment, so the
+// secret is never part of a command line or config file
+const credentialHelper = `!f() { test "$1" = get && echo "username=$PROTO_GIT_USERNAME" && echo "password=$PROTO_GIT_PASSWORD"; }; f`
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// gitAuthEnv returns the environment for running git against repoURL without
+// prompts, plus the secret values that must be redacted from its output. HTTPS
+// credentials are scoped to repoURL in git's config, so they are never sent
+// to another host git is pointed at, such as by a redirect or a submodule.
+func gitAuthEnv(auth Auth, repoURL string) ([]string, []string, error) {
+	env := append(os.Environ(),
+		// Fail instead of waiting for a password nobody will type
+		"GIT_TERMINAL_PROMPT=0",
+		"GCM_INTERACTIVE=never",
+	)
+	var secrets []string
+
+	if auth.SSHKey != "" {
+		key := expandHome(auth.SSHKey)
+		if _, err := os.Stat(key); err != nil {
+			return nil, nil, fmt.Errorf("ssh key %s: %v", auth.SSHKey, err)
+		}
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(key)+" -o IdentitiesOnly=yes -o BatchMode=yes")
+	} else if os.Getenv("GIT_SSH_COMMAND") == "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+
+	var username, password string
+	switch {
+	case auth.TokenEnv != "":
+		password = os.Getenv(auth.TokenEnv)
+		if password == "" {
+			return nil, nil, fmt.Errorf("environment variable %s named by auth.token_env is not set", auth.TokenEnv)
+		}
+		username = auth.TokenUser
+		if username == "" {
+			username = "x-access-token"
+		}
+	case auth.Netrc != "":
+		host := urlHost(repoURL)
+		login, secret, err := netrcCredentials(expandHome(auth.Netrc), host)
+		if err != nil {
+			return nil, nil, err
+		}
+		username, password = login, secret
+	default:
+		return env, nil, nil
+	}
+	secrets = append(secrets, password)
+
+	repo, host, ok := httpScopes(repoURL)
+	if !ok {
+		// Tokens are only ever sent over HTTP(S)
+		return env, secrets, nil
+	}
+	var configs [][2]string
+	switch auth.TokenMethod {
+	case "", "helper":
+		env = append(env, "PROTO_GIT_USERNAME="+username, "PROTO_GIT_PASSWORD="+password)
+		// An empty helper first clears helpers from the user's git config.
+		// git matches credential contexts by host only, since it leaves
+		// the path out unless credential.useHttpPath is set.
+		key := "credential." + host + ".helper"
+		configs = append(configs, [2]string{key, ""}, [2]string{key, credentialHelper})
+	case "header":
+		encoded := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		secrets = append(secrets, encoded)
+		configs = append(configs, [2]string{"http." + repo + ".extraHeader", "Authorization: Basic " + encoded})
+	default:
+		return nil, nil, fmt.Errorf("unknown auth.token_method %q, use helper or header", auth.TokenMethod)
+	}
+
+	return appendGitConfigEnv(env, configs), secrets, nil
+}
+
+// httpScopes returns repoURL without user info or trailing slash, and its
+// scheme and host, for scoping git config to the repository. ok is false for
+// URLs that are not HTTP(S).
+func httpScopes(repoURL string) (repo, host string, ok bool) {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", false
+	}
+	host = u.Scheme + "://" + u.Host
+	return host + strings.TrimRight(u.EscapedPath(), "/"), host, true
+}
+
+// appendGitConfigEnv passes config to git through GIT_CONFIG_* variables,
+// which keeps values out of the process arguments
+func appendGitConfigEnv(env []string, configs [][2]string) []string {
+	count := 0
+	for _, entry := range env {
+		if value, ok := strings.CutPrefix(entry, "GIT_CONFIG_COUNT="); ok {
+			count, _ = strconv.Atoi(value)
+		}
+	}
+	for _, config := range configs {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, config[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, config[1]),
+		)
+		count++
+	}
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", count))
+}
+
+// shellQuote quotes s for use in GIT_SSH_COMMAND, which git runs via a shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// urlHost returns the host of an http(s) URL, or "" for other URLs
+func urlHost(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// netrcCredentials looks up the login and password for host in a .netrc file
+func netrcCredentials(path, host string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading netrc file: %v", err)
+	}
+
+	fields := strings.Fields(string(data))
+	var login, password string
+	matched, found := false, false
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if found {
+				return login, password, nil
+			}
+			i++
+			matched = i < len(fields) && fields[i] == host
+			found = matched
+		case "default":
+			if found {
+				return login, password, nil
+			}
+			matched, found = true, true
+		case "login", "password", "account":
+			if i+1 >= len(fields) {
+				break
+			}
+			i++
+			if !matched {
+				continue
+			}
+			if fields[i-1] == "login" {
+				login = fields[i]
+			} else if fields[i-1] == "password" {
+				password = fields[i]
+			}
+		}
+	}
+	if !found {
+		return "", "", fmt.Errorf("no entry for %s in netrc file %s", host, path)
+	}
+	return login, password, nil
+}
+
+// RedactURL hides any password embedded in a URL's user info
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		return strings.Replace(u.String(), "xxxxx", "***", 1)
+	}
+	return rawURL
+}
+
+// hasEmbeddedPassword reports whether a URL carries a password in user info
+func hasEmbeddedPassword(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return false
+	}
+	_, hasPassword := u.User.Password()
+	return hasPassword
+}
+
+// redact replaces every secret in s
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "***")
+		}
+	}
+	return s
+}
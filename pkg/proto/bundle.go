@@ -0,0 +1,418 @@
+package proto
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundleFormatVersion is the bundle layout written by this release
+const BundleFormatVersion = 1
+
+const (
+	bundleManifestName = "bundle.yaml"
+	bundleChecksumName = "bundle.sha256"
+)
+
+// BundleManifest describes the sources packed into a bundle
+type BundleManifest struct {
+	Version int            `yaml:"version"`
+	Created time.Time      `yaml:"created"`
+	Sources []BundleSource `yaml:"sources"`
+}
+
+// BundleSource is the synced state of one source inside a bundle
+type BundleSource struct {
+	// Name is the dependency the files belong to, empty for the main source
+	Name string `yaml:"name,omitempty"`
+	// Location is the repository URL, path or archive URL the files were
+	// synced from, with credentials removed
+	Location string `yaml:"location"`
+	// GitHead and ContentHash are the sync state recorded in .proto_cache
+	GitHead     string `yaml:"git_head,omitempty"`
+	ContentHash string `yaml:"content_hash"`
+	// Files maps each file, relative to the source's directory, to its
+	// sha256
+	Files map[string]string `yaml:"files"`
+	// Provenance is the origin of each file, as recorded when it was synced
+	Provenance []FileProvenance `yaml:"provenance,omitempty"`
+}
+
+// provenance returns the manifest to record for the source's files. Files
+// without recorded provenance are attributed to the source as a whole.
+func (s BundleSource) provenance() *Provenance {
+	recorded := &Provenance{Files: s.Provenance}
+	now := time.Now().UTC().Truncate(time.Second)
+	provenance := &Provenance{}
+	for file, digest := range s.Files {
+		entry, ok := recorded.Lookup(file)
+		if !ok {
+			entry = FileProvenance{File: file, Source: s.Location, Commit: s.GitHead, Path: file, SyncedAt: now}
+		}
+		entry.SHA256 = digest
+		provenance.Files = append(provenance.Files, entry)
+	}
+	return provenance
+}
+
+// dir returns the directory holding the source's files inside the bundle
+func (s BundleSource) dir() string {
+	if s.Name == "" {
+		return "proto"
+	}
+	return "deps/" + s.Name
+}
+
+// sourceLocation identifies where a source is fetched from
+func sourceLocation(source Source) string {
+	switch source.Kind() {
+	case "path":
+		return source.LocalPath
+	case "archive":
+		return RedactURL(source.Archive.URL)
+	}
+	return RedactURL(source.GitHubURL)
+}
+
+// ExportBundle packs the files synced into ProtoDir and each dependency's
+// vendor directory, together with their sync state, into a .tar.gz at dest.
+// Every file's sha256 is listed in the bundle's manifest, and the manifest's
+// own sha256 is stored next to it, which catches a damaged bundle but not a
+// modified one, since the checksums travel with the files. It returns the
+// manifest and the sha256 of the bundle file, which an import must be given
+// to pin it.
+func ExportBundle(config *Config, dest string) (*BundleManifest, string, error) {
+	manifest := &BundleManifest{Version: BundleFormatVersion, Created: time.Now().UTC().Truncate(time.Second)}
+	contents := map[string][]byte{}
+	for _, s := range append([]Dependency{{Source: config.Source()}}, config.Deps...) {
+		label, dir := "proto directory", config.ProtoPath()
+		if s.Name != "" {
+			label, dir = "dependency "+s.Name, config.DepPath(s.Name)
+		}
+		state, err := readSyncState(dir)
+		if err != nil {
+			return nil, "", err
+		}
+		if state.ContentHash == "" {
+			return nil, "", fmt.Errorf("%s has not been synced; run 'proto sync' first", label)
+		}
+		files, err := findProtoFiles(dir)
+		if err != nil {
+			return nil, "", fmt.Errorf("error searching for proto files: %v", err)
+		}
+		// The hash is taken over what is actually exported, so an import
+		// records exactly the files it writes
+		hash, err := hashFiles(dir, files)
+		if err != nil {
+			return nil, "", err
+		}
+		recorded, err := LoadProvenance(dir)
+		if err != nil {
+			return nil, "", err
+		}
+		// Hand-edited or hand-written files would pass for upstream ones once
+		// imported
+		if recorded != nil {
+			synced := map[string]string{}
+			for _, origin := range recorded.Files {
+				synced[origin.File] = origin.SHA256
+			}
+			edited, _, err := localChanges(dir, synced)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, file := range files {
+				if _, ok := recorded.Lookup(file); !ok {
+					edited = append(edited, file)
+				}
+			}
+			sort.Strings(edited)
+			if len(edited) > 0 {
+				return nil, "", &LocalChangesError{Dir: dir, Files: edited}
+			}
+		}
+
+		entry := BundleSource{
+			Name:        s.Name,
+			Location:    sourceLocation(s.Source),
+			GitHead:     state.GitHead,
+			ContentHash: hash,
+			Files:       map[string]string{},
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+			if err != nil {
+				return nil, "", fmt.Errorf("error reading proto file %s: %v", file, err)
+			}
+			sum := sha256.Sum256(data)
+			entry.Files[file] = hex.EncodeToString(sum[:])
+			contents[entry.dir()+"/"+file] = data
+			if recorded != nil {
+				if origin, ok := recorded.Lookup(file); ok {
+					entry.Provenance = append(entry.Provenance, origin)
+				}
+			}
+		}
+		manifest.Sources = append(manifest.Sources, entry)
+	}
+
+	manifestYAML, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, "", fmt.Errorf("error marshaling bundle manifest: %v", err)
+	}
+	sum := sha256.Sum256(manifestYAML)
+
+	if err := writeBundle(dest, manifest.Created, manifestYAML, hex.EncodeToString(sum[:]), contents); err != nil {
+		return nil, "", err
+	}
+	digest, err := fileSHA256(dest)
+	if err != nil {
+		return nil, "", err
+	}
+	return manifest, digest, nil
+}
+
+// writeBundle writes the manifest, its checksum and the files, sorted by
+// name, as a .tar.gz. The file is written beside dest and renamed into place
+// so a failed export never leaves a truncated bundle behind.
+func writeBundle(dest string, modTime time.Time, manifestYAML []byte, checksum string, contents map[string][]byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".bundle-*")
+	if err != nil {
+		return fmt.Errorf("error creating bundle: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	err = write(bundleManifestName, manifestYAML)
+	if err == nil {
+		err = write(bundleChecksumName, []byte(checksum+"  "+bundleManifestName+"\n"))
+	}
+	for _, name := range names {
+		if err != nil {
+			break
+		}
+		err = write(name, contents[name])
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing bundle: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return fmt.Errorf("error writing bundle: %v", err)
+	}
+	return nil
+}
+
+// BundleError reports a bundle that is corrupt, has been tampered with or
+// does not match the configuration it is imported into
+type BundleError struct {
+	Path string
+	Err  error
+}
+
+func (e *BundleError) Error() string {
+	return fmt.Sprintf("invalid bundle %s: %v", e.Path, e.Err)
+}
+
+func (e *BundleError) Unwrap() error {
+	return e.Err
+}
+
+// importBundle restores ProtoDir and the dependency vendor directories from
+// a bundle written by ExportBundle. The bundle must match opts.BundleSHA256,
+// as anyone able to modify it can also rewrite the checksums inside, and
+// everything in it is verified before any file is written. Each source is handled like a sync: it is
+// skipped when its content hash matches the one in its cache, and otherwise
+// its files are copied and the bundle's sync state is recorded.
+func importBundle(config *Config, opts SyncOptions) (*SyncResult, error) {
+	bundlePath := opts.Bundle
+	invalid := func(format string, args ...any) error {
+		return &BundleError{Path: bundlePath, Err: fmt.Errorf(format, args...)}
+	}
+
+	if opts.BundleSHA256 == "" {
+		return nil, fmt.Errorf("importing bundle %s requires its sha256; pass the digest printed by 'proto bundle export'", bundlePath)
+	}
+	actual, err := fileSHA256(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	if actual != strings.ToLower(opts.BundleSHA256) {
+		return nil, invalid("sha256 is %s, want %s", actual, strings.ToLower(opts.BundleSHA256))
+	}
+
+	staging, err := os.MkdirTemp("", "proto-bundle-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := extractArchive(bundlePath, staging, nil); err != nil {
+		return nil, &BundleError{Path: bundlePath, Err: err}
+	}
+	manifest, err := readBundleManifest(staging)
+	if err != nil {
+		return nil, &BundleError{Path: bundlePath, Err: err}
+	}
+
+	// Match the bundle's sources to the configured ones
+	bundled := map[string]BundleSource{}
+	for _, source := range manifest.Sources {
+		bundled[source.Name] = source
+	}
+	type target struct {
+		bundle BundleSource
+		dir    string
+	}
+	var targets []target
+	for _, want := range append([]Dependency{{Source: config.Source()}}, config.Deps...) {
+		label := "the main source"
+		dir := config.ProtoPath()
+		if want.Name != "" {
+			label = "dependency " + want.Name
+			dir = config.DepPath(want.Name)
+		}
+		source, ok := bundled[want.Name]
+		if !ok {
+			return nil, invalid("it does not contain %s", label)
+		}
+		if location := sourceLocation(want.Source); source.Location != location {
+			return nil, invalid("%s was exported from %s, but .protorc syncs it from %s", label, source.Location, location)
+		}
+		targets = append(targets, target{bundle: source, dir: dir})
+	}
+
+	result := &SyncResult{}
+	for i, t := range targets {
+		files := make([]string, 0, len(t.bundle.Files))
+		for file := range t.bundle.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		sourceResult := &SyncResult{
+			Revision:    t.bundle.GitHead,
+			ContentHash: t.bundle.ContentHash,
+			Files:       files,
+			Name:        t.bundle.Name,
+		}
+		if i == 0 {
+			result = sourceResult
+		} else {
+			result.Deps = append(result.Deps, sourceResult)
+		}
+
+		sourceDir := filepath.Join(staging, filepath.FromSlash(t.bundle.dir()))
+		state := SyncState{GitHead: t.bundle.GitHead, ContentHash: t.bundle.ContentHash}
+		if err := installFiles(sourceDir, t.dir, t.bundle.Files, state, t.bundle.provenance(), opts, sourceResult); err != nil {
+			if t.bundle.Name != "" {
+				return nil, fmt.Errorf("dependency %s: %w", t.bundle.Name, err)
+			}
+			return nil, err
+		}
+	}
+
+	if !opts.DryRun {
+		if result.Unresolved, err = FindUnresolvedImports(config); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// readBundleManifest loads the manifest of an extracted bundle and checks it,
+// and every file it lists, against their checksums. Files the manifest does
+// not list are rejected too. This only catches bundles damaged in transit or
+// written inconsistently; authenticity comes from the pinned bundle digest.
+func readBundleManifest(dir string) (*BundleManifest, error) {
+	manifestYAML, err := os.ReadFile(filepath.Join(dir, bundleManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("missing %s", bundleManifestName)
+	}
+	checksum, err := os.ReadFile(filepath.Join(dir, bundleChecksumName))
+	if err != nil {
+		return nil, fmt.Errorf("missing %s", bundleChecksumName)
+	}
+	sum := sha256.Sum256(manifestYAML)
+	if fields := strings.Fields(string(checksum)); len(fields) == 0 || fields[0] != hex.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("%s does not match its checksum", bundleManifestName)
+	}
+
+	var manifest BundleManifest
+	if err := yaml.Unmarshal(manifestYAML, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", bundleManifestName, err)
+	}
+	if manifest.Version > BundleFormatVersion {
+		return nil, fmt.Errorf("bundle format version %d is newer than this release supports (%d); upgrade proto", manifest.Version, BundleFormatVersion)
+	}
+
+	listed := map[string]bool{bundleManifestName: true, bundleChecksumName: true}
+	for _, source := range manifest.Sources {
+		if source.Name != "" && !depNamePattern.MatchString(source.Name) {
+			return nil, fmt.Errorf("invalid dependency name %q", source.Name)
+		}
+		for file, want := range source.Files {
+			name := source.dir() + "/" + file
+			if path.Clean(name) != name || !strings.HasSuffix(file, ".proto") {
+				return nil, fmt.Errorf("invalid file name %q", file)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, fmt.Errorf("missing %s", name)
+			}
+			if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != want {
+				return nil, fmt.Errorf("%s does not match its checksum", name)
+			}
+			listed[name] = true
+		}
+	}
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if !listed[filepath.ToSlash(rel)] {
+			return fmt.Errorf("%s is not listed in %s", filepath.ToSlash(rel), bundleManifestName)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,188 @@
+package proto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Sync a project with a dependency and export it
+	online := filepath.Join(tempDir, "online")
+	writeFiles(t, online, map[string]string{
+		"upstream/api/service.proto":        "syntax = \"proto3\";\nimport \"google/api/http.proto\";\n",
+		"googleapis/google/api/http.proto":  "syntax = \"proto3\";\n",
+		"googleapis/google/type/date.proto": "syntax = \"proto3\";\n",
+	})
+	newConfig := func(dir string) *Config {
+		return &Config{
+			LocalPath: "upstream",
+			ProtoDir:  "./proto",
+			Deps: []Dependency{
+				{Name: "googleapis", Source: Source{LocalPath: "googleapis", Include: []string{"google/api/**"}}},
+			},
+			path: filepath.Join(dir, ConfigFileName),
+		}
+	}
+	if _, err := Sync(newConfig(online), SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	bundlePath := filepath.Join(tempDir, "protos.tar.gz")
+	manifest, digest, err := ExportBundle(newConfig(online), bundlePath)
+	if err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+	if len(manifest.Sources) != 2 || manifest.Sources[1].Name != "googleapis" || len(manifest.Sources[1].Files) != 1 {
+		t.Errorf("ExportBundle() manifest = %+v, want the main source and googleapis", manifest)
+	}
+
+	// Import into a project whose sources are not available
+	offline := filepath.Join(tempDir, "offline")
+	if err := os.MkdirAll(offline, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	result, err := Sync(newConfig(offline), SyncOptions{Bundle: bundlePath, BundleSHA256: digest})
+	if err != nil {
+		t.Fatalf("Sync() from bundle error = %v", err)
+	}
+	if result.UpToDate || len(result.Files) != 1 || len(result.Deps) != 1 || len(result.Unresolved) != 0 {
+		t.Errorf("Sync() from bundle = %+v, want one file, one dependency and no unresolved imports", result)
+	}
+	for _, name := range []string{"proto/api/service.proto", "proto_vendor/googleapis/google/api/http.proto"} {
+		if _, err := os.Stat(filepath.Join(offline, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s not restored: %v", name, err)
+		}
+	}
+	restored, err := LoadCache(newConfig(offline))
+	if err != nil {
+		t.Fatalf("LoadCache() error = %v", err)
+	}
+	if restored.ContentHash != manifest.Sources[0].ContentHash {
+		t.Errorf("restored cache = %+v, want content hash %s", restored, manifest.Sources[0].ContentHash)
+	}
+	exported, _ := LoadProvenance(filepath.Join(online, "proto"))
+	imported, _ := LoadProvenance(filepath.Join(offline, "proto"))
+	if exported == nil || !reflect.DeepEqual(imported, exported) {
+		t.Errorf("restored provenance = %+v, want %+v", imported, exported)
+	}
+
+	// A second import finds nothing to do
+	result, err = Sync(newConfig(offline), SyncOptions{Bundle: bundlePath, BundleSHA256: digest})
+	if err != nil {
+		t.Fatalf("Sync() from bundle error = %v", err)
+	}
+	if !result.UpToDate || !result.Deps[0].UpToDate {
+		t.Errorf("second Sync() from bundle = %+v, want up to date", result)
+	}
+
+	// The checksums inside a bundle can be rewritten along with its files,
+	// so it is only imported with its digest pinned
+	if _, err := Sync(newConfig(offline), SyncOptions{Bundle: bundlePath}); err == nil || !strings.Contains(err.Error(), "requires its sha256") {
+		t.Errorf("Sync() without sha256 error = %v, want the digest required", err)
+	}
+	var bundleErr *BundleError
+	if _, err := Sync(newConfig(offline), SyncOptions{Bundle: bundlePath, BundleSHA256: strings.Repeat("0", 64)}); !errors.As(err, &bundleErr) {
+		t.Errorf("Sync() with wrong sha256 error = %v, want a BundleError", err)
+	}
+	mismatched := newConfig(offline)
+	mismatched.LocalPath = "elsewhere"
+	if _, err := Sync(mismatched, SyncOptions{Bundle: bundlePath, BundleSHA256: digest}); err == nil || !strings.Contains(err.Error(), "exported from upstream") {
+		t.Errorf("Sync() with another source error = %v, want a source mismatch", err)
+	}
+
+	// A file written by hand next to the synced ones is not exported as
+	// upstream content
+	writeFiles(t, online, map[string]string{"proto/api/extra.proto": "syntax = \"proto3\";\n"})
+	var localErr *LocalChangesError
+	if _, _, err := ExportBundle(newConfig(online), bundlePath); !errors.As(err, &localErr) || !reflect.DeepEqual(localErr.Files, []string{"api/extra.proto"}) {
+		t.Errorf("ExportBundle() with an unsynced file error = %v, want a LocalChangesError for api/extra.proto", err)
+	}
+}
+
+func TestBundleTampered(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	writeFiles(t, tempDir, map[string]string{"upstream/service.proto": "syntax = \"proto3\";\n"})
+	config := &Config{LocalPath: "upstream", ProtoDir: "./proto", path: filepath.Join(tempDir, ConfigFileName)}
+	if _, _, err := ExportBundle(config, filepath.Join(tempDir, "unsynced.tar.gz")); err == nil {
+		t.Error("ExportBundle() before sync error = nil, want an error")
+	}
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	bundlePath := filepath.Join(tempDir, "protos.tar.gz")
+	if _, _, err := ExportBundle(config, bundlePath); err != nil {
+		t.Fatalf("ExportBundle() error = %v", err)
+	}
+
+	// Rebuild the bundle with changed contents
+	extracted := filepath.Join(tempDir, "extracted")
+	if err := ExtractArchive(bundlePath, extracted); err != nil {
+		t.Fatalf("ExtractArchive() error = %v", err)
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(extracted, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(data)
+	}
+	original := map[string]string{
+		"bundle.yaml":         read("bundle.yaml"),
+		"bundle.sha256":       read("bundle.sha256"),
+		"proto/service.proto": read("proto/service.proto"),
+	}
+
+	tests := []struct {
+		name   string
+		change map[string]string
+		want   string
+	}{
+		{"edited file", map[string]string{"proto/service.proto": "syntax = \"proto2\";\n"}, "proto/service.proto does not match"},
+		{"edited manifest", map[string]string{"bundle.yaml": original["bundle.yaml"] + "# edited\n"}, "bundle.yaml does not match"},
+		{"extra file", map[string]string{"proto/extra.proto": "syntax = \"proto3\";\n"}, "not listed"},
+		{"missing checksum", map[string]string{"bundle.sha256": ""}, "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			for name, content := range original {
+				files[name] = content
+			}
+			for name, content := range tt.change {
+				files[name] = content
+			}
+			tampered := filepath.Join(tempDir, "tampered.tar.gz")
+			writeTarGz(t, tampered, files)
+
+			before, _ := os.ReadFile(filepath.Join(tempDir, "proto", "service.proto"))
+			os.RemoveAll(filepath.Join(tempDir, "proto", ".proto_cache"))
+			// Pinning the modified bundle's own digest leaves the checks
+			// inside it to catch the damage
+			digest, err := fileSHA256(tampered)
+			if err != nil {
+				t.Fatalf("fileSHA256() error = %v", err)
+			}
+			_, err = Sync(config, SyncOptions{Bundle: tampered, BundleSHA256: digest})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Sync() from bundle error = %v, want %q", err, tt.want)
+			}
+			if after, _ := os.ReadFile(filepath.Join(tempDir, "proto", "service.proto")); string(after) != string(before) {
+				t.Error("a rejected bundle changed the proto directory")
+			}
+		})
+	}
+}
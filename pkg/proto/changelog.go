@@ -0,0 +1,230 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ChangesFileName is the file changelogs are written to with changelog: file
+const ChangesFileName = "CHANGES.md"
+
+// Changelog describes the upstream changes between two synced commits
+type Changelog struct {
+	From string
+	To   string
+	// Commits lists the commits between From and To that touched the
+	// synced directory, newest first
+	Commits []ChangelogCommit
+	// Changes lists the messages, fields, enums and RPCs that changed
+	Changes []SchemaChange
+	// Incomplete explains why the history could not be read in full
+	Incomplete string
+}
+
+// ChangelogCommit is one upstream commit
+type ChangelogCommit struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Subject string
+}
+
+// Markdown renders the changelog as a Markdown section
+func (c *Changelog) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s..%s\n\n", shortHash(c.From), shortHash(c.To))
+	if c.Incomplete != "" {
+		fmt.Fprintf(&b, "%s\n\n", c.Incomplete)
+	}
+
+	b.WriteString("### Commits\n\n")
+	if len(c.Commits) == 0 {
+		b.WriteString("No commits touched the synced files.\n")
+	}
+	for _, commit := range c.Commits {
+		fmt.Fprintf(&b, "- %s %s (%s, %s)\n", shortHash(commit.Hash), commit.Subject, commit.Author, commit.Date.Format("2006-01-02"))
+	}
+
+	b.WriteString("\n### Proto changes\n\n")
+	if len(c.Changes) == 0 {
+		b.WriteString("No messages, fields, enums or RPCs changed.\n")
+	}
+	for _, change := range c.Changes {
+		fmt.Fprintf(&b, "- %s\n", change)
+	}
+	return b.String()
+}
+
+// shortHash abbreviates a commit hash for display
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// buildChangelog reads the commits between from and to that touched the
+// source's synced directory, and compares the proto declarations of oldFiles
+// at from with those of newFiles at to. Files are relative to the synced
+// directory.
+func buildChangelog(git *Git, gitDir string, source Source, from, to string, oldFiles, newFiles []string) (*Changelog, error) {
+	changelog := &Changelog{From: from, To: to}
+	prefix := upstreamPrefix(source)
+
+	newSchema, err := readSchema(git, gitDir, to, prefix, newFiles)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := git.Run("--git-dir", gitDir, "cat-file", "-e", from+"^{commit}"); err != nil {
+		// History rewritten upstream, or a --since that does not exist
+		changelog.Incomplete = fmt.Sprintf("Commit %s is not in the repository, so the history and changes since it are unavailable.", shortHash(from))
+		return changelog, nil
+	}
+
+	output, err := git.Run(withPathspec([]string{"--git-dir", gitDir, "log", "--format=%H%x1f%an%x1f%aI%x1f%s", from + ".." + to}, prefix)...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading upstream history: %v", err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[2])
+		changelog.Commits = append(changelog.Commits, ChangelogCommit{Hash: fields[0], Author: fields[1], Date: date, Subject: fields[3]})
+	}
+
+	oldSchema, err := readSchema(git, gitDir, from, prefix, oldFiles)
+	if err != nil {
+		return nil, err
+	}
+	changelog.Changes = diffSchemas(oldSchema, newSchema)
+	return changelog, nil
+}
+
+// withPathspec limits a git command to dir, if set
+func withPathspec(args []string, dir string) []string {
+	if dir == "" {
+		return args
+	}
+	return append(args, "--", dir)
+}
+
+// readSchema parses files, relative to prefix, as of a commit. Files that do
+// not exist at the commit are skipped.
+func readSchema(git *Git, gitDir, commit, prefix string, files []string) (*protoSchema, error) {
+	schema := newProtoSchema()
+	for _, file := range files {
+		object := commit + ":" + path.Join(prefix, file)
+		if _, err := git.Run("--git-dir", gitDir, "cat-file", "-e", object); err != nil {
+			continue
+		}
+		data, err := git.Run("--git-dir", gitDir, "cat-file", "blob", object)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", object, err)
+		}
+		schema.addFile([]byte(data))
+	}
+	return schema, nil
+}
+
+// writeChangesFile adds a changelog to the top of CHANGES.md in dir, below
+// the file's title
+func writeChangesFile(dir string, changelog *Changelog) error {
+	const title = "# Upstream changes\n\n"
+	changesPath := filepath.Join(dir, ChangesFileName)
+	existing, err := os.ReadFile(changesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %v", ChangesFileName, err)
+	}
+	// Date the heading so entries can be told apart
+	entry := strings.Replace(changelog.Markdown(), "\n", fmt.Sprintf(" (synced %s)\n", time.Now().Format("2006-01-02")), 1)
+	rest := strings.TrimPrefix(string(existing), title)
+	content := title + entry
+	if rest != "" {
+		content += "\n" + rest
+	}
+	if err := os.WriteFile(changesPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", ChangesFileName, err)
+	}
+	return nil
+}
+
+// Log builds the changelog of the main source from since to the synced
+// commit, using the cached mirror without fetching. Without since, it
+// covers the last sync that moved to a new commit.
+func Log(config *Config, since string) (*Changelog, error) {
+	source := config.Source()
+	if source.Kind() != "git" {
+		return nil, fmt.Errorf("proto log needs a github_url source, which has commits to compare")
+	}
+	state, err := LoadCache(config)
+	if err != nil {
+		return nil, err
+	}
+	if state.GitHead == "" {
+		return nil, fmt.Errorf("nothing has been synced yet; run 'proto sync' first")
+	}
+	if since == "" {
+		since = state.PreviousHead
+	}
+	if since == "" {
+		return nil, fmt.Errorf("no earlier synced commit is recorded; pass --since <commit>")
+	}
+
+	git, err := NewGit(source.Auth, source.GitHubURL)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring authentication: %v", err)
+	}
+	mirror, unlock, err := updateMirror(git, source.GitHubURL, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if resolved, err := git.Run("--git-dir", mirror, "rev-parse", "--verify", "--quiet", since+"^{commit}"); err == nil {
+		since = resolved
+	}
+
+	provenance, err := LoadProvenance(config.ProtoPath())
+	if err != nil {
+		return nil, err
+	}
+	if provenance == nil {
+		return nil, fmt.Errorf("%s has no provenance manifest; run 'proto sync' first", config.ProtoPath())
+	}
+	var files []string
+	for _, entry := range provenance.Files {
+		files = append(files, entry.File)
+	}
+
+	// The files selected back then are not recorded, so select them again
+	// from the old tree. Roots would need the old import graph, so with
+	// roots the current selection is used.
+	oldFiles := files
+	if len(source.Roots) == 0 {
+		prefix := upstreamPrefix(source)
+		if output, err := git.Run(withPathspec([]string{"--git-dir", mirror, "ls-tree", "-r", "--name-only", since}, prefix)...); err == nil {
+			var found []string
+			for _, name := range strings.Split(output, "\n") {
+				rel := name
+				if prefix != "" {
+					var ok bool
+					if rel, ok = strings.CutPrefix(name, prefix+"/"); !ok {
+						continue
+					}
+				}
+				if strings.HasSuffix(rel, ".proto") {
+					found = append(found, rel)
+				}
+			}
+			if oldFiles, _, err = filterFiles(found, source.Include, source.Exclude); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buildChangelog(git, mirror, source, since, state.GitHead, oldFiles, files)
+}
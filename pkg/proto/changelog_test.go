@@ -0,0 +1,102 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncChangelog(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	bare, work := createRepo(t, tempDir, map[string]string{
+		"protos/user.proto": "syntax = \"proto3\";\npackage v1;\nmessage User { string id = 1; }\n",
+		"protos/old.proto":  "syntax = \"proto3\";\npackage v1;\nmessage Old {}\n",
+		"README.md":         "docs\n",
+	})
+	config := &Config{
+		GitHubURL:  "file://" + bare,
+		Branch:     "main",
+		RemotePath: "protos",
+		ProtoDir:   "./proto",
+		Changelog:  "file",
+		path:       filepath.Join(tempDir, ConfigFileName),
+	}
+	first, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if first.Changelog != nil {
+		t.Errorf("first Sync() changelog = %+v, want none", first.Changelog)
+	}
+
+	commitFiles(t, work, bare, "Add email to User", map[string]string{
+		"protos/user.proto": "syntax = \"proto3\";\npackage v1;\nmessage User { string id = 1; string email = 2; }\n",
+	})
+	commitFiles(t, work, bare, "Update docs", map[string]string{"README.md": "more docs\n"})
+	runGit(t, work, "rm", "-q", "protos/old.proto")
+	head := commitFiles(t, work, bare, "Remove Old", nil)
+
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	changelog := result.Changelog
+	if changelog == nil || changelog.From != first.Revision || changelog.To != head {
+		t.Fatalf("Sync() changelog = %+v, want %s..%s", changelog, first.Revision, head)
+	}
+	var subjects []string
+	for _, commit := range changelog.Commits {
+		subjects = append(subjects, commit.Subject)
+	}
+	if want := []string{"Remove Old", "Add email to User"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("changelog commits = %v, want %v", subjects, want)
+	}
+	var changes []string
+	for _, change := range changelog.Changes {
+		changes = append(changes, change.String())
+	}
+	if want := []string{"Removed message v1.Old", "Added field v1.User.email (string = 2)"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changelog changes = %v, want %v", changes, want)
+	}
+
+	changesFile, err := os.ReadFile(filepath.Join(tempDir, "proto", ChangesFileName))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", ChangesFileName, err)
+	}
+	for _, want := range []string{"# Upstream changes", "Add email to User", "Added field v1.User.email"} {
+		if !strings.Contains(string(changesFile), want) {
+			t.Errorf("%s does not contain %q:\n%s", ChangesFileName, want, changesFile)
+		}
+	}
+
+	// proto log reproduces the report of the last sync, or from any commit
+	logged, err := Log(config, "")
+	if err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	if !reflect.DeepEqual(logged, changelog) {
+		t.Errorf("Log() = %+v, want %+v", logged, changelog)
+	}
+	logged, err = Log(config, head[:7]+"~1")
+	if err != nil {
+		t.Fatalf("Log() with since error = %v", err)
+	}
+	if len(logged.Commits) != 1 || logged.Commits[0].Subject != "Remove Old" {
+		t.Errorf("Log() with since commits = %+v, want only the last commit", logged.Commits)
+	}
+	if logged, err := Log(config, strings.Repeat("0", 40)); err != nil || logged.Incomplete == "" {
+		t.Errorf("Log() with unknown commit = %+v, %v, want an incomplete changelog", logged, err)
+	}
+}
@@ -8,13 +8,100 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// ConfigFileName is the name of the proto configuration file
+const ConfigFileName = ".protorc"
+
+// ConfigFile overrides config discovery when set, e.g. by the --config flag
+var ConfigFile string
+
 // Config represents the proto configuration
 type Config struct {
-	GitHubURL  string `yaml:"github_url"`
-	Branch     string `yaml:"branch"`
-	RemotePath string `yaml:"remote_path"`
-	ProtoDir   string `yaml:"proto_dir"`
-	BuildDir   string `yaml:"build_dir"`
+	Version    int           `yaml:"version"`
+	GitHubURL  string        `yaml:"github_url"`
+	LocalPath  string        `yaml:"path,omitempty"`
+	Archive    ArchiveSource `yaml:"archive,omitempty"`
+	Branch     string        `yaml:"branch"`
+	RemotePath string        `yaml:"remote_path"`
+	Include    []string      `yaml:"include,omitempty"`
+	Exclude    []string      `yaml:"exclude,omitempty"`
+	Roots      []string      `yaml:"roots,omitempty"`
+
+	// VerifySignatures and AllowedSigners are described on Source
+	VerifySignatures bool   `yaml:"verify_signatures,omitempty"`
+	AllowedSigners   string `yaml:"allowed_signers,omitempty"`
+
+	ProtoDir  string       `yaml:"proto_dir"`
+	BuildDir  string       `yaml:"build_dir"`
+	VendorDir string       `yaml:"vendor_dir,omitempty"`
+	Changelog string       `yaml:"changelog,omitempty"`
+	Deps      []Dependency `yaml:"deps,omitempty"`
+	Auth      Auth         `yaml:"auth,omitempty"`
+	Toolchain Toolchain    `yaml:"toolchain,omitempty"`
+	Python    Python       `yaml:"python,omitempty"`
+	Hooks     Hooks        `yaml:"hooks,omitempty"`
+
+	// path is the file the config was loaded from or saved to
+	path string
+	// origins records where each overridden or loaded setting came from
+	origins map[string]string
+	// migrations lists the format upgrades applied in memory on load
+	migrations []string
+	// legacyGitHead is a gitHead read from a pre-versioning .protorc
+	legacyGitHead string
+}
+
+// Path returns the file the config was loaded from or saved to
+func (c *Config) Path() string {
+	return c.path
+}
+
+// ResolvePath resolves a path from the config against the directory holding
+// the config file, so commands behave the same from any subdirectory. The
+// result is relative to the working directory when possible.
+func (c *Config) ResolvePath(p string) string {
+	if c.path == "" || filepath.IsAbs(p) {
+		return p
+	}
+	resolved := filepath.Join(filepath.Dir(c.path), p)
+	if workDir, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(workDir, resolved); err == nil {
+			return rel
+		}
+	}
+	return resolved
+}
+
+// Source returns the main source configured at the top level of .protorc
+func (c *Config) Source() Source {
+	return Source{
+		GitHubURL:  c.GitHubURL,
+		LocalPath:  c.LocalPath,
+		Archive:    c.Archive,
+		Branch:     c.Branch,
+		RemotePath: c.RemotePath,
+		Include:    c.Include,
+		Exclude:    c.Exclude,
+		Roots:      c.Roots,
+
+		VerifySignatures: c.VerifySignatures,
+		AllowedSigners:   c.AllowedSigners,
+		Auth:             c.Auth,
+	}
+}
+
+// SourceKind returns how the main source is fetched, see Source.Kind
+func (c *Config) SourceKind() string {
+	return c.Source().Kind()
+}
+
+// ProtoPath returns ProtoDir resolved against the config file's directory
+func (c *Config) ProtoPath() string {
+	return c.ResolvePath(c.ProtoDir)
+}
+
+// BuildPath returns BuildDir resolved against the config file's directory
+func (c *Config) BuildPath() string {
+	return c.ResolvePath(c.BuildDir)
 }
 
 // getCachePath returns the path to the cache file
@@ -22,41 +109,112 @@ func getCachePath(protoDir string) string {
 	return filepath.Join(protoDir, ".proto_cache")
 }
 
-// LoadConfig loads the proto configuration from .protorc
-func LoadConfig() (*Config, error) {
+// CacheDir returns the per-user cache directory for proto, which holds data
+// shared between projects. It can be overridden with PROTO_CACHE_DIR.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("PROTO_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating user cache directory: %v", err)
+	}
+	return filepath.Join(userCache, "proto"), nil
+}
+
+// configOverride returns the config path set by ConfigFile or PROTO_CONFIG
+func configOverride() string {
+	if ConfigFile != "" {
+		return ConfigFile
+	}
+	return os.Getenv("PROTO_CONFIG")
+}
+
+// FindConfig returns the path of the config file to use. ConfigFile and then
+// PROTO_CONFIG take precedence; otherwise the working directory and each of
+// its parents are searched for .protorc, the way git searches for .git.
+func FindConfig() (string, error) {
+	if override := configOverride(); override != "" {
+		return override, nil
+	}
+
 	workDir, err := os.Getwd()
 	if err != nil {
-		return nil, fmt.Errorf("error getting current directory: %v", err)
+		return "", fmt.Errorf("error getting current directory: %v", err)
+	}
+	for dir := workDir; ; dir = filepath.Dir(dir) {
+		configPath := filepath.Join(dir, ConfigFileName)
+		if info, err := os.Stat(configPath); err == nil && !info.IsDir() {
+			return configPath, nil
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return "", fmt.Errorf("no %s found in %s or any parent directory", ConfigFileName, workDir)
+}
+
+// LoadConfig loads the proto configuration from the discovered .protorc and
+// layers PROTO_* environment variables on top of it
+func LoadConfig() (*Config, error) {
+	configPath, err := FindConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Apply(EnvOverrides()); err != nil {
+		return nil, err
 	}
 
-	configPath := filepath.Join(workDir, ".protorc")
+	return config, nil
+}
+
+// ReadConfig loads the configuration stored in a file, without applying any
+// environment overrides
+func ReadConfig(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file: %v", err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing config file: %v", err)
+	config, err := parseConfig(data, configPath)
+	if err != nil {
+		return nil, err
 	}
 
-	return &config, nil
+	return config, nil
 }
 
-// SaveConfig saves the proto configuration to .protorc
+// SaveConfig saves the proto configuration. A loaded config is written back to
+// the file it came from; a new one goes to the --config or PROTO_CONFIG path,
+// or to .protorc in the working directory.
 func SaveConfig(config *Config) error {
-	workDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("error getting current directory: %v", err)
+	configPath := config.path
+	if configPath == "" {
+		configPath = configOverride()
+	}
+	if configPath == "" {
+		workDir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("error getting current directory: %v", err)
+		}
+		configPath = filepath.Join(workDir, ConfigFileName)
+	}
+	config.path = configPath
+	if config.Version == 0 {
+		config.Version = CurrentConfigVersion
 	}
 
 	// Ensure proto directory exists
-	if err := os.MkdirAll(config.ProtoDir, 0755); err != nil {
+	if err := os.MkdirAll(config.ProtoPath(), 0755); err != nil {
 		return fmt.Errorf("error creating proto directory: %v", err)
 	}
 
 	// Save config file
-	configPath := filepath.Join(workDir, ".protorc")
 	data, err := yaml.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("error marshaling config: %v", err)
@@ -68,45 +226,65 @@ func SaveConfig(config *Config) error {
 	return nil
 }
 
-// SaveCache saves the git head to the cache file
-func SaveCache(config *Config, gitHead string) error {
-	// Ensure proto directory exists
-	if err := os.MkdirAll(config.ProtoDir, 0755); err != nil {
+// SyncState records what was last synced into ProtoDir
+type SyncState struct {
+	// GitHead is the synced commit, empty for sources without one
+	GitHead string `yaml:"git_head,omitempty"`
+	// PreviousHead is the commit synced before GitHead, for proto log
+	PreviousHead string `yaml:"previous_git_head,omitempty"`
+	// ContentHash identifies the synced set of files and their contents
+	ContentHash string `yaml:"content_hash,omitempty"`
+}
+
+// SaveCache saves the sync state of the main source to the cache file
+func SaveCache(config *Config, state SyncState) error {
+	return writeSyncState(config.ProtoPath(), state)
+}
+
+// writeSyncState saves the sync state of the files synced into dir
+func writeSyncState(dir string, state SyncState) error {
+	// Ensure the directory exists
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("error creating proto directory: %v", err)
 	}
 
 	// Save cache file
-	cacheData := map[string]string{
-		"git_head": gitHead,
-	}
-	cacheYAML, err := yaml.Marshal(cacheData)
+	cacheYAML, err := yaml.Marshal(state)
 	if err != nil {
 		return fmt.Errorf("error marshaling cache data: %v", err)
 	}
 
-	cachePath := getCachePath(config.ProtoDir)
-	if err := os.WriteFile(cachePath, cacheYAML, 0644); err != nil {
+	if err := os.WriteFile(getCachePath(dir), cacheYAML, 0644); err != nil {
 		return fmt.Errorf("error writing cache file: %v", err)
 	}
 
 	return nil
 }
 
-// LoadCache loads the cache data from the cache file
-func LoadCache(config *Config) (string, error) {
-	cachePath := getCachePath(config.ProtoDir)
-	data, err := os.ReadFile(cachePath)
+// LoadCache loads the sync state of the main source from the cache file
+func LoadCache(config *Config) (SyncState, error) {
+	if _, err := os.Stat(getCachePath(config.ProtoPath())); os.IsNotExist(err) {
+		// Configs from before the cache file kept the head in .protorc
+		return SyncState{GitHead: config.legacyGitHead}, nil
+	}
+	return readSyncState(config.ProtoPath())
+}
+
+// readSyncState loads the sync state of the files synced into dir. A missing
+// cache file yields an empty state.
+func readSyncState(dir string) (SyncState, error) {
+	data, err := os.ReadFile(getCachePath(dir))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", nil
+			return SyncState{}, nil
 		}
-		return "", fmt.Errorf("error reading cache file: %v", err)
+		return SyncState{}, fmt.Errorf("error reading cache file: %v", err)
 	}
 
-	var cacheData map[string]string
-	if err := yaml.Unmarshal(data, &cacheData); err != nil {
-		return "", fmt.Errorf("error parsing cache file: %v", err)
+	var state SyncState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return SyncState{}, fmt.Errorf("error parsing cache file: %v", err)
 	}
 
-	return cacheData["git_head"], nil
+	return state, nil
 }
@@ -3,9 +3,23 @@ package proto
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
+// enterDir changes the working directory for the duration of a test
+func enterDir(t *testing.T, dir string) {
+	t.Helper()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change to %s: %v", dir, err)
+	}
+	t.Cleanup(func() { os.Chdir(originalDir) })
+}
+
 func TestConfig(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir, err := os.MkdirTemp("", "proto-test-*")
@@ -13,11 +27,7 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
-
-	// Override home directory for testing
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tempDir)
-	defer os.Setenv("HOME", originalHome)
+	enterDir(t, tempDir)
 
 	// Test cases
 	tests := []struct {
@@ -33,7 +43,6 @@ func TestConfig(t *testing.T) {
 				RemotePath: "api/proto",
 				ProtoDir:   "./proto",
 				BuildDir:   "./gen",
-				GitHead:    "abc123",
 			},
 			wantErr: false,
 		},
@@ -45,7 +54,6 @@ func TestConfig(t *testing.T) {
 				RemotePath: "",
 				ProtoDir:   "",
 				BuildDir:   "",
-				GitHead:    "",
 			},
 			wantErr: false,
 		},
@@ -83,9 +91,6 @@ func TestConfig(t *testing.T) {
 				if got.BuildDir != tt.config.BuildDir {
 					t.Errorf("LoadConfig() BuildDir = %v, want %v", got.BuildDir, tt.config.BuildDir)
 				}
-				if got.GitHead != tt.config.GitHead {
-					t.Errorf("LoadConfig() GitHead = %v, want %v", got.GitHead, tt.config.GitHead)
-				}
 			}
 		})
 	}
@@ -98,22 +103,18 @@ func TestLoadConfigNonExistent(t *testing.T) {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
-
-	// Override home directory for testing
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tempDir)
-	defer os.Setenv("HOME", originalHome)
+	enterDir(t, tempDir)
 
 	// Test loading non-existent config
 	config, err := LoadConfig()
-	if err != nil {
-		t.Errorf("LoadConfig() error = %v, want nil", err)
+	if err == nil {
+		t.Fatal("LoadConfig() error = nil, want error")
 	}
-	if config == nil {
-		t.Error("LoadConfig() returned nil config, want empty config")
+	if config != nil {
+		t.Error("LoadConfig() returned a config for a non-existent file")
 	}
-	if config.GitHubURL != "" || config.Branch != "" || config.RemotePath != "" || config.ProtoDir != "" || config.BuildDir != "" || config.GitHead != "" {
-		t.Error("LoadConfig() returned non-empty config for non-existent file")
+	if !strings.Contains(err.Error(), "no .protorc found") {
+		t.Errorf("LoadConfig() error = %v, want it to mention the missing .protorc", err)
 	}
 }
 
@@ -124,11 +125,15 @@ func TestSaveConfigInvalidPath(t *testing.T) {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
 
-	// Override home directory for testing with an invalid path
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", filepath.Join(tempDir, "nonexistent"))
-	defer os.Setenv("HOME", originalHome)
+	// Point the config below a regular file, which can never be a directory
+	blocker := filepath.Join(tempDir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	ConfigFile = filepath.Join(blocker, ".protorc")
+	defer func() { ConfigFile = "" }()
 
 	config := &Config{
 		GitHubURL:  "https://github.com/example/repo",
@@ -136,7 +141,6 @@ func TestSaveConfigInvalidPath(t *testing.T) {
 		RemotePath: "api/proto",
 		ProtoDir:   "./proto",
 		BuildDir:   "./gen",
-		GitHead:    "abc123",
 	}
 
 	// Test saving to invalid path
@@ -145,3 +149,102 @@ func TestSaveConfigInvalidPath(t *testing.T) {
 		t.Error("SaveConfig() error = nil, want error")
 	}
 }
+
+func TestLoadConfigFromSubdirectory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tempDir, _ = filepath.EvalSymlinks(tempDir)
+
+	protorc := "github_url: https://github.com/example/repo\nproto_dir: ./proto\nbuild_dir: /abs/gen\n"
+	if err := os.WriteFile(filepath.Join(tempDir, ".protorc"), []byte(protorc), 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+	subDir := filepath.Join(tempDir, "services", "api")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	enterDir(t, subDir)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.Path() != filepath.Join(tempDir, ".protorc") {
+		t.Errorf("Path() = %v, want %v", config.Path(), filepath.Join(tempDir, ".protorc"))
+	}
+
+	// Relative directories resolve against the config file, not the cwd
+	if got := config.ProtoPath(); got != filepath.Join("..", "..", "proto") {
+		t.Errorf("ProtoPath() = %v, want %v", got, filepath.Join("..", "..", "proto"))
+	}
+	if got := config.BuildPath(); got != "/abs/gen" {
+		t.Errorf("BuildPath() = %v, want /abs/gen", got)
+	}
+
+	// Saving writes back to the discovered file
+	config.Branch = "develop"
+	if err := SaveConfig(config); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(subDir, ".protorc")); err == nil {
+		t.Error("SaveConfig() created .protorc in the working directory")
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, ".protorc"))
+	if err != nil || !strings.Contains(string(data), "branch: develop") {
+		t.Errorf("SaveConfig() did not update the discovered file: %s", data)
+	}
+}
+
+func TestConfigOverride(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	for _, name := range []string{"discovered", "env", "flag"} {
+		dir := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		protorc := "branch: " + name + "\n"
+		if err := os.WriteFile(filepath.Join(dir, ".protorc"), []byte(protorc), 0644); err != nil {
+			t.Fatalf("Failed to write .protorc: %v", err)
+		}
+	}
+	enterDir(t, filepath.Join(tempDir, "discovered"))
+
+	originalEnv := os.Getenv("PROTO_CONFIG")
+	defer os.Setenv("PROTO_CONFIG", originalEnv)
+
+	tests := []struct {
+		name string
+		env  string
+		flag string
+		want string
+	}{
+		{name: "discovery", want: "discovered"},
+		{name: "env", env: filepath.Join(tempDir, "env", ".protorc"), want: "env"},
+		{name: "flag wins over env", env: filepath.Join(tempDir, "env", ".protorc"), flag: filepath.Join(tempDir, "flag", ".protorc"), want: "flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("PROTO_CONFIG", tt.env)
+			ConfigFile = tt.flag
+			defer func() { ConfigFile = "" }()
+
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if config.Branch != tt.want {
+				t.Errorf("LoadConfig() Branch = %v, want %v", config.Branch, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultVendorDir is where dependencies are synced when vendor_dir is unset
+const DefaultVendorDir = "./proto_vendor"
+
+// Dependency is a third-party source whose proto files are imported by the
+// synced files. Dependencies are synced into their own directory under
+// VendorDir and passed to protoc as include paths, but no code is generated
+// for them.
+type Dependency struct {
+	// Name identifies the dependency and names its vendor directory
+	Name   string `yaml:"name"`
+	Source `yaml:",inline"`
+}
+
+// knownDependencies maps import prefixes of widely used proto repositories
+// to the dependency that provides them, for suggesting missing deps
+var knownDependencies = []struct {
+	prefix string
+	name   string
+	url    string
+}{
+	{"google/api/", "googleapis", "https://github.com/googleapis/googleapis"},
+	{"google/rpc/", "googleapis", "https://github.com/googleapis/googleapis"},
+	{"google/type/", "googleapis", "https://github.com/googleapis/googleapis"},
+	{"google/longrunning/", "googleapis", "https://github.com/googleapis/googleapis"},
+	{"google/iam/", "googleapis", "https://github.com/googleapis/googleapis"},
+	{"validate/", "protoc-gen-validate", "https://github.com/bufbuild/protoc-gen-validate"},
+	{"buf/validate/", "protovalidate", "https://github.com/bufbuild/protovalidate"},
+	{"protoc-gen-openapiv2/", "grpc-gateway", "https://github.com/grpc-ecosystem/grpc-gateway"},
+}
+
+// wellKnownPrefix is the import prefix of the well-known types, which ship
+// with protoc and never need to be synced
+const wellKnownPrefix = "google/protobuf/"
+
+// depNamePattern matches names usable as a vendor subdirectory
+var depNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// VendorPath returns VendorDir, or its default, resolved against the config
+// file's directory
+func (c *Config) VendorPath() string {
+	if c.VendorDir == "" {
+		return c.ResolvePath(DefaultVendorDir)
+	}
+	return c.ResolvePath(c.VendorDir)
+}
+
+// DepPath returns the directory a dependency is synced into
+func (c *Config) DepPath(name string) string {
+	return filepath.Join(c.VendorPath(), name)
+}
+
+// DepIncludePaths returns the synced dependency directories, for use as
+// protoc include paths
+func (c *Config) DepIncludePaths() []string {
+	var paths []string
+	for _, dep := range c.Deps {
+		if info, err := os.Stat(c.DepPath(dep.Name)); err == nil && info.IsDir() {
+			paths = append(paths, c.DepPath(dep.Name))
+		}
+	}
+	return paths
+}
+
+// validateDeps reports problems with the deps list
+func (c *Config) validateDeps() []string {
+	var problems []string
+	seen := map[string]bool{}
+	for i, dep := range c.Deps {
+		label := fmt.Sprintf("deps[%d]", i)
+		if dep.Name != "" {
+			label = "dependency " + dep.Name
+		}
+		switch {
+		case dep.Name == "":
+			problems = append(problems, label+": name is required")
+		case !depNamePattern.MatchString(dep.Name):
+			problems = append(problems, fmt.Sprintf("%s: name may only contain letters, digits, '.', '_' and '-'", label))
+		case seen[dep.Name]:
+			problems = append(problems, label+": name is used more than once")
+		}
+		seen[dep.Name] = true
+
+		sources := 0
+		for _, set := range []bool{dep.GitHubURL != "", dep.LocalPath != "", dep.Archive.URL != ""} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			problems = append(problems, label+": set exactly one of github_url, path and archive.url")
+		}
+		if hasEmbeddedPassword(dep.GitHubURL) {
+			problems = append(problems, label+": github_url must not contain credentials")
+		}
+		problems = append(problems, validateSignatures(label+": ", dep.Source)...)
+		problems = append(problems, validateAuth(label+": ", dep.Auth)...)
+		if dep.Archive.URL != "" && !sha256Pattern.MatchString(dep.Archive.SHA256) {
+			problems = append(problems, label+": archive.sha256 must be the 64 hex digit sha256 of the archive")
+		}
+		for _, pattern := range append(append([]string{}, dep.Include...), dep.Exclude...) {
+			if err := ValidateGlob(pattern); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", label, err))
+			}
+		}
+	}
+	return problems
+}
+
+// UnresolvedImport is an import that none of the synced files provide
+type UnresolvedImport struct {
+	// File is the importing file, relative to ProtoDir or prefixed with the
+	// vendor directory of the dependency it belongs to
+	File string
+	// Import is the imported path
+	Import string
+	// Dependency names the dependency expected to provide the import, or is
+	// empty if it is unknown
+	Dependency string
+	// URL is where a known but unconfigured dependency can be fetched from
+	URL string
+	// Configured is set when Dependency is already in deps, meaning its
+	// remote_path or include patterns leave the file out
+	Configured bool
+}
+
+// String describes the problem and how to fix it
+func (u UnresolvedImport) String() string {
+	message := fmt.Sprintf("%s imports %q, which was not found", u.File, u.Import)
+	switch {
+	case u.Configured:
+		return message + fmt.Sprintf(": dependency %s does not provide it, check its remote_path and include patterns", u.Dependency)
+	case u.Dependency != "":
+		return message + fmt.Sprintf(": add the %s dependency (%s) to deps", u.Dependency, u.URL)
+	}
+	return message + ": no configured dependency provides it"
+}
+
+// FindUnresolvedImports checks every import of the files in ProtoDir and the
+// vendored dependencies against those same files, the well-known types and
+// the managed protoc include directory
+func FindUnresolvedImports(config *Config) ([]UnresolvedImport, error) {
+	roots := syncedDirs(config)
+	var includeDirs []string
+	for _, r := range roots {
+		includeDirs = append(includeDirs, r.dir)
+	}
+	if include := config.Toolchain.ManagedIncludeDir(); include != "" {
+		includeDirs = append(includeDirs, include)
+	}
+
+	configured := map[string]bool{}
+	for _, dep := range config.Deps {
+		configured[dep.Name] = true
+	}
+
+	var unresolved []UnresolvedImport
+	for _, r := range roots {
+		if _, err := os.Stat(r.dir); os.IsNotExist(err) {
+			continue
+		}
+		files, err := findProtoFiles(r.dir)
+		if err != nil {
+			return nil, fmt.Errorf("error searching for proto files: %v", err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(filepath.Join(r.dir, filepath.FromSlash(file)))
+			if err != nil {
+				return nil, fmt.Errorf("error reading proto file %s: %v", file, err)
+			}
+			for _, imported := range ParseImports(data) {
+				if resolveImport(imported, includeDirs) {
+					continue
+				}
+				missing := UnresolvedImport{File: file, Import: imported}
+				if r.label != "" {
+					missing.File = r.label + "/" + file
+				}
+				for _, known := range knownDependencies {
+					if strings.HasPrefix(imported, known.prefix) {
+						missing.Dependency, missing.URL = known.name, known.url
+						missing.Configured = configured[known.name]
+						break
+					}
+				}
+				unresolved = append(unresolved, missing)
+			}
+		}
+	}
+
+	sort.SliceStable(unresolved, func(i, j int) bool {
+		return unresolved[i].Dependency < unresolved[j].Dependency
+	})
+	return unresolved, nil
+}
+
+// resolveImport reports whether an import can be found by protoc
+func resolveImport(imported string, includeDirs []string) bool {
+	if strings.HasPrefix(imported, wellKnownPrefix) {
+		return true
+	}
+	for _, dir := range includeDirs {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(imported))); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImports(t *testing.T) {
+	src := `syntax = "proto3";
+// import "commented/out.proto";
+/* import "block/comment.proto";
+   still a comment */
+import "google/api/annotations.proto";
+import public "shared/types.proto";
+import weak "legacy/old.proto" ;
+option go_package = "example.com/api//v1"; import "after/string.proto";
+`
+	want := []string{"google/api/annotations.proto", "shared/types.proto", "legacy/old.proto", "after/string.proto"}
+	if got := ParseImports([]byte(src)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseImports() = %v, want %v", got, want)
+	}
+}
+
+func TestSyncDeps(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"upstream/api/service.proto": `syntax = "proto3";
+import "google/api/annotations.proto";
+import "google/protobuf/empty.proto";
+import "validate/validate.proto";
+`,
+		"googleapis/google/api/annotations.proto": "syntax = \"proto3\";\nimport \"google/api/http.proto\";\n",
+		"googleapis/google/api/http.proto":        "syntax = \"proto3\";\n",
+		"googleapis/google/type/date.proto":       "syntax = \"proto3\";\n",
+		"pgv/validate/validate.proto":             "syntax = \"proto3\";\n",
+	})
+	config := &Config{
+		LocalPath: "upstream",
+		ProtoDir:  "./proto",
+		Deps: []Dependency{
+			{Name: "googleapis", Source: Source{LocalPath: "googleapis", Include: []string{"google/api/**"}}},
+		},
+		path: filepath.Join(tempDir, ConfigFileName),
+	}
+
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if len(result.Deps) != 1 || result.Deps[0].Name != "googleapis" || len(result.Deps[0].Files) != 2 {
+		t.Errorf("Sync() deps = %+v, want googleapis with 2 files", result.Deps)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "proto_vendor", "googleapis", "google", "api", "annotations.proto")); err != nil {
+		t.Errorf("dependency not vendored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "proto", "google")); !os.IsNotExist(err) {
+		t.Error("dependency files were copied into the proto directory")
+	}
+
+	// The well-known type resolves, the validate import names its dependency
+	if len(result.Unresolved) != 1 {
+		t.Fatalf("Sync() unresolved = %v, want one import", result.Unresolved)
+	}
+	missing := result.Unresolved[0]
+	if missing.File != "api/service.proto" || missing.Import != "validate/validate.proto" || missing.Dependency != "protoc-gen-validate" || missing.Configured {
+		t.Errorf("unresolved = %+v, want validate/validate.proto from protoc-gen-validate", missing)
+	}
+	if !strings.Contains(missing.String(), "add the protoc-gen-validate dependency") {
+		t.Errorf("String() = %q, want a hint to add the dependency", missing.String())
+	}
+
+	config.Deps = append(config.Deps, Dependency{Name: "protoc-gen-validate", Source: Source{LocalPath: "pgv"}})
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !result.UpToDate || !result.Deps[0].UpToDate || result.Deps[1].UpToDate {
+		t.Errorf("Sync() = %+v, want only the new dependency synced", result)
+	}
+	if len(result.Unresolved) != 0 {
+		t.Errorf("Sync() unresolved = %v, want none", result.Unresolved)
+	}
+	if got := config.DepIncludePaths(); len(got) != 2 {
+		t.Errorf("DepIncludePaths() = %v, want both dependencies", got)
+	}
+}
+
+func TestValidateDeps(t *testing.T) {
+	config := &Config{
+		Deps: []Dependency{
+			{Source: Source{LocalPath: "a"}},
+			{Name: "dup", Source: Source{LocalPath: "a"}},
+			{Name: "dup", Source: Source{LocalPath: "a", GitHubURL: "https://example.com/a.git"}},
+			{Name: "../escape", Source: Source{LocalPath: "a"}},
+		},
+	}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want errors")
+	}
+	for _, want := range []string{"name is required", "used more than once", "exactly one of", "may only contain"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want it to mention %q", err, want)
+		}
+	}
+}
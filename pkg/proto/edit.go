@@ -0,0 +1,189 @@
+package proto
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetConfigValue sets a dotted key in a config file, keeping the rest of the
+// file and its comments intact. The value is parsed as YAML, so lists and
+// booleans can be set too. The file is only written if the result is valid.
+func SetConfigValue(configPath, key, value string) error {
+	valueNode := parseValueNode(value)
+	return editConfigFile(configPath, func(root *yaml.Node) error {
+		parts := strings.Split(key, ".")
+		node := root
+		for _, part := range parts[:len(parts)-1] {
+			child := mappingValue(node, part)
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, child)
+			}
+			if child.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s is not a mapping", part)
+			}
+			node = child
+		}
+
+		last := parts[len(parts)-1]
+		if existing := mappingValue(node, last); existing != nil {
+			// Keep comments attached to the old value
+			valueNode.HeadComment = existing.HeadComment
+			valueNode.LineComment = existing.LineComment
+			*existing = *valueNode
+			return nil
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, valueNode)
+		return nil
+	})
+}
+
+// UnsetConfigValue removes a dotted key from a config file, dropping any
+// mappings left empty
+func UnsetConfigValue(configPath, key string) error {
+	return editConfigFile(configPath, func(root *yaml.Node) error {
+		if !removeKey(root, strings.Split(key, ".")) {
+			return fmt.Errorf("key %s is not set", key)
+		}
+		return nil
+	})
+}
+
+// GetConfigValue returns the YAML for a dotted key in a config file
+func GetConfigValue(configPath, key string) (string, bool, error) {
+	root, err := readConfigNode(configPath)
+	if err != nil {
+		return "", false, err
+	}
+	node := root
+	for _, part := range strings.Split(key, ".") {
+		if node = mappingValue(node, part); node == nil {
+			return "", false, nil
+		}
+	}
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, true, nil
+	}
+	data, err := encodeNode(node)
+	if err != nil {
+		return "", false, fmt.Errorf("error marshaling %s: %v", key, err)
+	}
+	return strings.TrimRight(string(data), "\n"), true, nil
+}
+
+// encodeNode renders a node with the two-space indent used by .protorc
+func encodeNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseValueNode interprets a command-line value as YAML, falling back to a
+// plain string for anything that parses as a mapping
+func parseValueNode(value string) *yaml.Node {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err == nil && len(doc.Content) == 1 {
+		node := doc.Content[0]
+		if node.Kind == yaml.ScalarNode || node.Kind == yaml.SequenceNode {
+			node.Line, node.Column = 0, 0
+			return node
+		}
+	}
+	node := &yaml.Node{}
+	node.SetString(value)
+	return node
+}
+
+// readConfigNode parses a config file into its root mapping node
+func readConfigNode(configPath string) (*yaml.Node, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", configPath, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing config file %s: top level must be a mapping", configPath)
+	}
+	return root, nil
+}
+
+// editConfigFile applies edit to the parsed config file and writes it back
+// if the edited config still validates
+func editConfigFile(configPath string, edit func(root *yaml.Node) error) error {
+	root, err := readConfigNode(configPath)
+	if err != nil {
+		return err
+	}
+	if err := edit(root); err != nil {
+		return err
+	}
+
+	data, err := encodeNode(root)
+	if err != nil {
+		return fmt.Errorf("error marshaling config: %v", err)
+	}
+
+	if _, err := parseConfig(data, configPath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
+
+// mappingValue returns the value node for key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeKey deletes the dotted path from node, reporting whether it existed
+func removeKey(node *yaml.Node, parts []string) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return true
+		}
+		child := node.Content[i+1]
+		if !removeKey(child, parts[1:]) {
+			return false
+		}
+		if child.Kind == yaml.MappingNode && len(child.Content) == 0 {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package proto
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// Git runs git commands for one repository without ever prompting, using
+// the credentials configured for it
+type Git struct {
+	// Dir is the working directory git runs in
+	Dir string
+
+	env     []string
+	secrets []string
+}
+
+// NewGit prepares a git runner for repoURL with the given credentials
+func NewGit(auth Auth, repoURL string) (*Git, error) {
+	env, secrets, err := gitAuthEnv(auth, repoURL)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(repoURL); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			secrets = append(secrets, password)
+		}
+	}
+	return &Git{env: env, secrets: secrets}, nil
+}
+
+// Run runs git with args and returns its trimmed standard output. Errors
+// include git's standard error with any secrets redacted.
+func (g *Git) Run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.Dir
+	cmd.Env = g.env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(g.Redact(stderr.String()))
+		if message == "" {
+			return "", fmt.Errorf("git %s: %v", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, message)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Redact removes the runner's secrets from s
+func (g *Git) Redact(s string) string {
+	return redact(s, g.secrets)
+}
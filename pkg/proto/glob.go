@@ -0,0 +1,107 @@
+package proto
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether a slash-separated name matches a doublestar glob
+// pattern. Besides the path.Match syntax (*, ?, [class]) it supports "**" as
+// a whole path segment, matching zero or more directories, and {a,b}
+// alternatives.
+func MatchGlob(pattern, name string) (bool, error) {
+	for _, expanded := range expandBraces(pattern) {
+		matched, err := matchSegments(strings.Split(expanded, "/"), strings.Split(name, "/"))
+		if err != nil {
+			return false, fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidateGlob checks that a pattern is well-formed
+func ValidateGlob(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty glob")
+	}
+	if strings.Count(pattern, "{") != strings.Count(pattern, "}") {
+		return fmt.Errorf("invalid glob %q: unbalanced braces", pattern)
+	}
+	for _, expanded := range expandBraces(pattern) {
+		for _, segment := range strings.Split(expanded, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid glob %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchSegments matches pattern segments against name segments
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated ** and try every possible split
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchSegments(pattern, name[i:])
+				if matched || err != nil {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// expandBraces expands {a,b} alternatives into every pattern they describe
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		return []string{pattern}
+	}
+	// Find the matching close brace, splitting on top-level commas
+	depth, start := 0, open+1
+	var options []string
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				options = append(options, pattern[start:i])
+				var expanded []string
+				for _, option := range options {
+					expanded = append(expanded, expandBraces(pattern[:open]+option+pattern[i+1:])...)
+				}
+				return expanded
+			}
+		case ',':
+			if depth == 1 {
+				options = append(options, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	// An unclosed brace is matched literally
+	return []string{pattern}
+}
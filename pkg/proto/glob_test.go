@@ -0,0 +1,42 @@
+package proto
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.proto", "service.proto", true},
+		{"*.proto", "api/service.proto", false},
+		{"**/*.proto", "service.proto", true},
+		{"**/*.proto", "api/v1/service.proto", true},
+		{"api/**", "api/v1/service.proto", true},
+		{"api/**", "other/service.proto", false},
+		{"**/internal/**", "api/internal/x.proto", true},
+		{"**/internal", "api/internal", true},
+		{"**/v1alpha*/**", "api/v1alpha2/x.proto", true},
+		{"**/v1alpha*/**", "api/v1/x.proto", false},
+		{"api/**/test_*.proto", "api/test_a.proto", true},
+		{"api/{v1,v2}/*.proto", "api/v2/x.proto", true},
+		{"api/{v1,v2}/*.proto", "api/v3/x.proto", false},
+		{"api/v?/[a-c].proto", "api/v1/b.proto", true},
+	}
+	for _, tt := range tests {
+		got, err := MatchGlob(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("MatchGlob(%q, %q) error = %v", tt.pattern, tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"", "api/[", "api/{v1,v2"} {
+		if err := ValidateGlob(pattern); err == nil {
+			t.Errorf("ValidateGlob(%q) error = nil, want error", pattern)
+		}
+	}
+}
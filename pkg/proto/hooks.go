@@ -0,0 +1,219 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Hook stages
+const (
+	HookPreSync  = "pre_sync"
+	HookPostSync = "post_sync"
+	HookPreGen   = "pre_gen"
+	HookPostGen  = "post_gen"
+)
+
+// Hooks lists shell commands run before and after sync and gen. The lists at
+// the top level run for every target; those under a target only run when
+// generating that target, after the top-level ones.
+type Hooks struct {
+	PreSync  []string    `yaml:"pre_sync,omitempty"`
+	PostSync []string    `yaml:"post_sync,omitempty"`
+	PreGen   []string    `yaml:"pre_gen,omitempty"`
+	PostGen  []string    `yaml:"post_gen,omitempty"`
+	Go       TargetHooks `yaml:"go,omitempty"`
+	Python   TargetHooks `yaml:"python,omitempty"`
+}
+
+// TargetHooks lists the gen hooks of one target
+type TargetHooks struct {
+	PreGen  []string `yaml:"pre_gen,omitempty"`
+	PostGen []string `yaml:"post_gen,omitempty"`
+}
+
+// commands returns the hooks to run at stage for target, which is empty for
+// sync stages
+func (h Hooks) commands(stage, target string) []string {
+	var targetHooks TargetHooks
+	switch target {
+	case "go":
+		targetHooks = h.Go
+	case "python":
+		targetHooks = h.Python
+	}
+	switch stage {
+	case HookPreSync:
+		return h.PreSync
+	case HookPostSync:
+		return h.PostSync
+	case HookPreGen:
+		return append(append([]string(nil), h.PreGen...), targetHooks.PreGen...)
+	case HookPostGen:
+		return append(append([]string(nil), h.PostGen...), targetHooks.PostGen...)
+	}
+	return nil
+}
+
+// validate reports empty hook commands
+func (h Hooks) validate() []string {
+	var problems []string
+	for _, list := range []struct {
+		key      string
+		commands []string
+	}{
+		{"hooks.pre_sync", h.PreSync},
+		{"hooks.post_sync", h.PostSync},
+		{"hooks.pre_gen", h.PreGen},
+		{"hooks.post_gen", h.PostGen},
+		{"hooks.go.pre_gen", h.Go.PreGen},
+		{"hooks.go.post_gen", h.Go.PostGen},
+		{"hooks.python.pre_gen", h.Python.PreGen},
+		{"hooks.python.post_gen", h.Python.PostGen},
+	} {
+		for _, command := range list.commands {
+			if strings.TrimSpace(command) == "" {
+				problems = append(problems, list.key+" must not contain empty commands")
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// HookContext describes what a hook runs for
+type HookContext struct {
+	// Target is the SDK type being generated, empty for sync hooks
+	Target string
+	// Revision is the synced commit of the main source, for post_sync
+	Revision string
+	// Changed lists the files the stage is about: for post_sync the synced
+	// files that were added or modified, for pre_gen the proto files about
+	// to be generated, and for post_gen the files gen wrote
+	Changed []string
+}
+
+// HookError reports a hook that failed
+type HookError struct {
+	Stage   string
+	Command string
+	Err     error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook %q failed: %v", e.Stage, e.Command, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// RunHooks runs the hooks configured for stage, in order, from the directory
+// holding .protorc, stopping at the first failure. Besides the caller's
+// environment, hooks get PROTO_HOOK, PROTO_TARGET, PROTO_PROTO_DIR,
+// PROTO_BUILD_DIR, PROTO_REVISION and PROTO_CHANGED_FILES, which lists one
+// file per line relative to the hook's working directory.
+func RunHooks(config *Config, stage string, hookContext HookContext) error {
+	commands := config.Hooks.commands(stage, hookContext.Target)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	dir := "."
+	if config.path != "" {
+		dir = filepath.Dir(config.path)
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	absolute := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			return abs
+		}
+		return p
+	}
+	var changed []string
+	for _, file := range hookContext.Changed {
+		if rel, err := filepath.Rel(absDir, absolute(file)); err == nil {
+			file = rel
+		}
+		changed = append(changed, filepath.ToSlash(file))
+	}
+	env := append(os.Environ(),
+		"PROTO_HOOK="+stage,
+		"PROTO_TARGET="+hookContext.Target,
+		"PROTO_PROTO_DIR="+absolute(config.ProtoPath()),
+		"PROTO_BUILD_DIR="+absolute(config.BuildPath()),
+		"PROTO_REVISION="+hookContext.Revision,
+		"PROTO_CHANGED_FILES="+strings.Join(changed, "\n"),
+	)
+
+	for _, command := range commands {
+		cmd := shellCommand(command)
+		cmd.Dir = absDir
+		cmd.Env = env
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return &HookError{Stage: stage, Command: command, Err: err}
+		}
+	}
+	return nil
+}
+
+// shellCommand runs command with the platform's shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// FileTimes records the modification times of the files under a directory,
+// to tell which files a command wrote
+type FileTimes map[string]time.Time
+
+// ReadFileTimes records the modification time of every file under dir. A
+// missing dir has no files.
+func ReadFileTimes(dir string) (FileTimes, error) {
+	times := FileTimes{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			times[path] = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+	return times, nil
+}
+
+// Changed returns the files under dir added or modified since t was recorded,
+// sorted
+func (t FileTimes) Changed(dir string) ([]string, error) {
+	current, err := ReadFileTimes(dir)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for path, modTime := range current {
+		if previous, ok := t[path]; !ok || !previous.Equal(modTime) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
@@ -0,0 +1,172 @@
+package proto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in this test use sh syntax")
+	}
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+	if err := os.Mkdir("sub", 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	enterDir(t, filepath.Join(tempDir, "sub"))
+
+	config := &Config{
+		ProtoDir: "./proto",
+		BuildDir: "./gen",
+		Hooks: Hooks{
+			PostGen: []string{`echo "shared $PROTO_HOOK $PROTO_TARGET" >> hooks.log`},
+			Go: TargetHooks{PostGen: []string{
+				`echo "go $PROTO_BUILD_DIR" >> hooks.log`,
+				`printf '%s\n' "$PROTO_CHANGED_FILES" >> hooks.log`,
+			}},
+			Python: TargetHooks{PostGen: []string{`echo python >> hooks.log`}},
+		},
+		path: filepath.Join(tempDir, ConfigFileName),
+	}
+	// Hooks run from the directory holding .protorc and get paths relative
+	// to it, wherever proto was run from
+	err = RunHooks(config, HookPostGen, HookContext{
+		Target:  "go",
+		Changed: []string{filepath.Join("..", "gen", "api", "service.pb.go"), filepath.Join(tempDir, "gen", "api", "service_grpc.pb.go")},
+	})
+	if err != nil {
+		t.Fatalf("RunHooks() error = %v", err)
+	}
+	log, err := os.ReadFile(filepath.Join(tempDir, "hooks.log"))
+	if err != nil {
+		t.Fatalf("Failed to read hook output: %v", err)
+	}
+	realTemp, _ := filepath.EvalSymlinks(tempDir)
+	want := "shared post_gen go\ngo " + filepath.Join(tempDir, "gen") + "\ngen/api/service.pb.go\ngen/api/service_grpc.pb.go\n"
+	if got := strings.ReplaceAll(string(log), realTemp, tempDir); got != want {
+		t.Errorf("Hook output = %q, want %q", got, want)
+	}
+
+	// A failing hook stops the hooks after it
+	config.Hooks = Hooks{PreSync: []string{"exit 3", "touch never"}}
+	err = RunHooks(config, HookPreSync, HookContext{})
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) || hookErr.Stage != HookPreSync || hookErr.Command != "exit 3" {
+		t.Errorf("RunHooks() error = %v, want a HookError for \"exit 3\"", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "never")); !os.IsNotExist(err) {
+		t.Error("RunHooks() ran the hook after a failing one")
+	}
+}
+
+func TestSyncHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in this test use sh syntax")
+	}
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"source/api/service.proto": "syntax = \"proto3\";\n",
+		"source/api/user.proto":    "syntax = \"proto3\";\n",
+	})
+	config := &Config{
+		LocalPath: "source",
+		ProtoDir:  "./proto",
+		Hooks: Hooks{
+			PreSync:  []string{"test ! -e fail"},
+			PostSync: []string{`printf '%s\n' "$PROTO_CHANGED_FILES" > changed.log`},
+		},
+		path: filepath.Join(tempDir, ConfigFileName),
+	}
+	readChanged := func() string {
+		data, err := os.ReadFile(filepath.Join(tempDir, "changed.log"))
+		if err != nil {
+			t.Fatalf("Failed to read hook output: %v", err)
+		}
+		return string(data)
+	}
+
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if got, want := readChanged(), "proto/api/service.proto\nproto/api/user.proto\n"; got != want {
+		t.Errorf("PROTO_CHANGED_FILES after the first sync = %q, want %q", got, want)
+	}
+
+	writeFiles(t, tempDir, map[string]string{"source/api/user.proto": "syntax = \"proto2\";\n"})
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Changed, []string{"api/user.proto"}) {
+		t.Errorf("Sync() changed = %v, want [api/user.proto]", result.Changed)
+	}
+	if got, want := readChanged(), "proto/api/user.proto\n"; got != want {
+		t.Errorf("PROTO_CHANGED_FILES after an update = %q, want %q", got, want)
+	}
+
+	// A failing pre_sync hook fails the sync before anything is copied
+	writeFiles(t, tempDir, map[string]string{"fail": "", "source/api/user.proto": "syntax = \"proto3\";\n"})
+	var hookErr *HookError
+	if _, err := Sync(config, SyncOptions{}); !errors.As(err, &hookErr) {
+		t.Fatalf("Sync() error = %v, want a HookError", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tempDir, "proto", "api", "user.proto")); string(data) != "syntax = \"proto2\";\n" {
+		t.Errorf("Sync() copied files despite the failing pre_sync hook")
+	}
+
+	// Dry runs skip hooks
+	if _, err := Sync(config, SyncOptions{DryRun: true}); err != nil {
+		t.Errorf("Sync() dry run error = %v, want hooks skipped", err)
+	}
+}
+
+func TestFileTimes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	buildDir := filepath.Join(tempDir, "gen")
+
+	before, err := ReadFileTimes(buildDir)
+	if err != nil {
+		t.Fatalf("ReadFileTimes() of a missing dir error = %v", err)
+	}
+	writeFiles(t, tempDir, map[string]string{"gen/a.pb.go": "a", "gen/b.pb.go": "b"})
+	changed, err := before.Changed(buildDir)
+	if err != nil {
+		t.Fatalf("Changed() error = %v", err)
+	}
+	if want := []string{filepath.Join(buildDir, "a.pb.go"), filepath.Join(buildDir, "b.pb.go")}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Changed() = %v, want %v", changed, want)
+	}
+
+	before, err = ReadFileTimes(buildDir)
+	if err != nil {
+		t.Fatalf("ReadFileTimes() error = %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(buildDir, "b.pb.go"), later, later); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	if changed, err = before.Changed(buildDir); err != nil || !reflect.DeepEqual(changed, []string{filepath.Join(buildDir, "b.pb.go")}) {
+		t.Errorf("Changed() = %v, %v, want only b.pb.go", changed, err)
+	}
+}
@@ -0,0 +1,181 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// importPattern matches an import statement once comments are removed
+var importPattern = regexp.MustCompile(`\bimport\s+(?:(?:public|weak)\s+)?"([^"]+)"\s*;`)
+
+// ParseImports returns the files imported by a .proto file, in order
+func ParseImports(data []byte) []string {
+	var imports []string
+	for _, match := range importPattern.FindAllStringSubmatch(stripComments(string(data)), -1) {
+		imports = append(imports, match[1])
+	}
+	return imports
+}
+
+// stripComments blanks out // and /* */ comments, leaving string literals
+// alone so a "//" inside an option value is not mistaken for a comment
+func stripComments(src string) string {
+	var b strings.Builder
+	b.Grow(len(src))
+	for i := 0; i < len(src); i++ {
+		switch {
+		case src[i] == '"' || src[i] == '\'':
+			quote := src[i]
+			b.WriteByte(quote)
+			for i++; i < len(src) && src[i] != quote && src[i] != '\n'; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					b.WriteByte(src[i])
+					i++
+				}
+				b.WriteByte(src[i])
+			}
+			if i < len(src) {
+				b.WriteByte(src[i])
+			}
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			if i < len(src) {
+				b.WriteByte('\n')
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return b.String()
+			}
+			// Keep newlines so positions by line stay meaningful
+			b.WriteString(strings.Repeat("\n", strings.Count(src[i:i+2+end], "\n")))
+			b.WriteByte(' ')
+			i += end + 3
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return b.String()
+}
+
+// packagePattern matches a package statement once comments are removed
+var packagePattern = regexp.MustCompile(`\bpackage\s+([A-Za-z_][A-Za-z0-9_.]*)\s*;`)
+
+// ParsePackage returns the proto package a file declares, or ""
+func ParsePackage(data []byte) string {
+	if match := packagePattern.FindStringSubmatch(stripComments(string(data))); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// ImportNotFoundError reports an import, reachable from the roots, that
+// neither the source nor anything else on the include path provides
+type ImportNotFoundError struct {
+	File   string
+	Import string
+}
+
+func (e *ImportNotFoundError) Error() string {
+	message := fmt.Sprintf("%s imports %q, which is not in the source, a dependency or the well-known types", e.File, e.Import)
+	for _, known := range knownDependencies {
+		if strings.HasPrefix(e.Import, known.prefix) {
+			return message + fmt.Sprintf(" (add the %s dependency (%s) to deps)", known.name, known.url)
+		}
+	}
+	return message
+}
+
+// importClosure returns the files reachable from roots by following imports.
+// files are the candidates, relative to dir. A root is a .proto file, a
+// directory or a proto package name. Imports outside files must satisfy
+// external. It also returns what each root matched.
+func importClosure(dir string, files, roots []string, external func(string) bool) ([]string, []PatternMatch, error) {
+	available := map[string]bool{}
+	for _, file := range files {
+		available[file] = true
+	}
+
+	// Packages are only parsed when a root needs them
+	var packages map[string][]string
+	packageFiles := func(name string) ([]string, error) {
+		if packages == nil {
+			packages = map[string][]string{}
+			for _, file := range files {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+				if err != nil {
+					return nil, fmt.Errorf("error reading proto file %s: %v", file, err)
+				}
+				pkg := ParsePackage(data)
+				packages[pkg] = append(packages[pkg], file)
+			}
+		}
+		return packages[name], nil
+	}
+
+	var matches []PatternMatch
+	var queue []string
+	for _, root := range roots {
+		root = strings.Trim(path.Clean(filepath.ToSlash(root)), "/")
+		var matched []string
+		switch {
+		case available[root]:
+			matched = []string{root}
+		case !strings.HasSuffix(root, ".proto"):
+			for _, file := range files {
+				if strings.HasPrefix(file, root+"/") {
+					matched = append(matched, file)
+				}
+			}
+			if len(matched) == 0 {
+				var err error
+				if matched, err = packageFiles(root); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		if len(matched) == 0 {
+			return nil, nil, fmt.Errorf("root %q matches no file, directory or package in the source", root)
+		}
+		matches = append(matches, PatternMatch{Kind: "root", Pattern: root, Files: matched})
+		queue = append(queue, matched...)
+	}
+
+	selected := map[string]bool{}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if selected[file] {
+			continue
+		}
+		selected[file] = true
+
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading proto file %s: %v", file, err)
+		}
+		for _, imported := range ParseImports(data) {
+			switch {
+			case available[imported]:
+				queue = append(queue, imported)
+			case external(imported):
+			default:
+				return nil, nil, &ImportNotFoundError{File: file, Import: imported}
+			}
+		}
+	}
+
+	closure := make([]string, 0, len(selected))
+	for file := range selected {
+		closure = append(closure, file)
+	}
+	sort.Strings(closure)
+	return closure, matches, nil
+}
@@ -0,0 +1,317 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// InstalledTool is a tool version present in the managed toolchain directory
+type InstalledTool struct {
+	Name    string
+	Version string
+	Dir     string
+}
+
+// ToolchainDir returns the directory managed toolchains are installed into
+func ToolchainDir() (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "toolchain"), nil
+}
+
+// ExactVersion returns the version a constraint pins, if it pins exactly one
+func ExactVersion(constraint string) (string, bool) {
+	c := strings.TrimPrefix(strings.TrimSpace(constraint), "=")
+	if c == "" || versionPattern.FindString(c) != c {
+		return "", false
+	}
+	return strings.TrimPrefix(c, "v"), true
+}
+
+// KnownTool reports whether tool is run by a generation target or pinned in
+// the toolchain, and so may be installed
+func (t Toolchain) KnownTool(tool string) bool {
+	if t.Constraint(tool) != "" {
+		return true
+	}
+	for _, tools := range TargetTools {
+		for _, name := range tools {
+			if name == tool {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getInstallDir returns the directory a tool version is installed into. The
+// tool and version come from the command line and .protorc, so both are
+// checked to name a single directory inside the toolchain directory.
+func getInstallDir(tool, version string) (string, error) {
+	if tool == "" || tool == "." || tool == ".." || strings.ContainsAny(tool, `/\`) {
+		return "", fmt.Errorf("invalid tool name %q", tool)
+	}
+	if exact, ok := ExactVersion(version); !ok || exact != version {
+		return "", fmt.Errorf("invalid version %q for %s, expected an exact version such as 25.1", version, tool)
+	}
+	toolchainDir, err := ToolchainDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(toolchainDir, tool, version)
+	if rel, err := filepath.Rel(toolchainDir, dir); err != nil || rel != filepath.Join(tool, version) {
+		return "", fmt.Errorf("install directory for %s %s is outside %s", tool, version, toolchainDir)
+	}
+	return dir, nil
+}
+
+// findBinary looks for a tool's executable in an installed or extracted tree
+func findBinary(dir, tool string) (string, bool) {
+	for _, candidate := range []string{filepath.Join(dir, "bin", tool), filepath.Join(dir, tool)} {
+		info, err := os.Stat(candidate)
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// ManagedToolPath returns the executable of an installed tool version
+func ManagedToolPath(tool, version string) (string, bool) {
+	dir, err := getInstallDir(tool, version)
+	if err != nil {
+		return "", false
+	}
+	return findBinary(dir, tool)
+}
+
+// managedVersion returns the installed version of a pinned tool to run: the
+// pinned version for an exact pin, or the highest installed version that
+// satisfies a range, the same versions prune keeps
+func (t Toolchain) managedVersion(tool string) (string, bool) {
+	if version, ok := ExactVersion(t.Constraint(tool)); ok {
+		_, found := ManagedToolPath(tool, version)
+		return version, found
+	}
+	installed, err := ListInstalledTools()
+	if err != nil {
+		return "", false
+	}
+	// Installed versions are sorted, so the last match is the highest
+	for i := len(installed) - 1; i >= 0; i-- {
+		candidate := installed[i]
+		if candidate.Name != tool || !t.Keeps(candidate) {
+			continue
+		}
+		if _, ok := ManagedToolPath(tool, candidate.Version); ok {
+			return candidate.Version, true
+		}
+	}
+	return "", false
+}
+
+// LookPath locates a tool, preferring the pinned version from the managed
+// toolchain directory over whatever is on PATH
+func (t Toolchain) LookPath(tool string) (string, error) {
+	if version, ok := t.managedVersion(tool); ok {
+		if path, ok := ManagedToolPath(tool, version); ok {
+			return path, nil
+		}
+	}
+	return exec.LookPath(tool)
+}
+
+// ManagedBinDirs returns the directories holding installed binaries for the
+// pinned tools, so they can be put ahead of PATH when running protoc
+func (t Toolchain) ManagedBinDirs() []string {
+	var dirs []string
+	for _, tool := range t.Pinned() {
+		version, ok := t.managedVersion(tool)
+		if !ok {
+			continue
+		}
+		if path, ok := ManagedToolPath(tool, version); ok {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+	return dirs
+}
+
+// ManagedIncludeDir returns the well-known type include directory shipped
+// with the managed protoc, or "" if protoc is not managed
+func (t Toolchain) ManagedIncludeDir() string {
+	version, ok := t.managedVersion("protoc")
+	if !ok {
+		return ""
+	}
+	dir, err := getInstallDir("protoc", version)
+	if err != nil {
+		return ""
+	}
+	include := filepath.Join(dir, "include")
+	if info, err := os.Stat(include); err == nil && info.IsDir() {
+		return include
+	}
+	return ""
+}
+
+// MirrorArchiveNames returns the archive file names looked up in a mirror
+// for a tool version on the current platform
+func MirrorArchiveNames(tool, version string) []string {
+	base := fmt.Sprintf("%s-%s-%s-%s", tool, version, runtime.GOOS, runtime.GOARCH)
+	return []string{base + ".tar.gz", base + ".tgz", base + ".zip"}
+}
+
+// InstallTool installs a tool version from an archive, given as a local path
+// or URL, into the managed toolchain directory
+func InstallTool(tool, version, archive string) (string, error) {
+	dir, err := getInstallDir(tool, version)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("error creating toolchain directory: %v", err)
+	}
+
+	// Stage the install next to its final location so the rename is atomic
+	tempDir, err := os.MkdirTemp(filepath.Dir(dir), ".install-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, "archive")
+	if err := DownloadFile(archive, archivePath); err != nil {
+		return "", err
+	}
+	rootDir := filepath.Join(tempDir, "root")
+	if err := ExtractArchive(archivePath, rootDir); err != nil {
+		return "", err
+	}
+	if _, ok := findBinary(rootDir, tool); !ok {
+		return "", fmt.Errorf("archive %s does not contain %s or bin/%s", archive, tool, tool)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("error removing previous install: %v", err)
+	}
+	if err := os.Rename(rootDir, dir); err != nil {
+		return "", fmt.Errorf("error installing %s %s: %v", tool, version, err)
+	}
+	return dir, nil
+}
+
+// InstallFromMirror installs a tool version from the first matching archive
+// in mirror, which may be a local directory or an http(s) URL
+func InstallFromMirror(tool, version, mirror string) (string, error) {
+	var tried []string
+	for _, name := range MirrorArchiveNames(tool, version) {
+		var src string
+		if strings.HasPrefix(mirror, "http://") || strings.HasPrefix(mirror, "https://") {
+			src = strings.TrimSuffix(mirror, "/") + "/" + name
+		} else {
+			src = filepath.Join(strings.TrimPrefix(mirror, "file://"), name)
+			if _, err := os.Stat(src); err != nil {
+				tried = append(tried, name)
+				continue
+			}
+		}
+
+		dir, err := InstallTool(tool, version, src)
+		if err == nil {
+			return dir, nil
+		}
+		tried = append(tried, fmt.Sprintf("%s (%v)", name, err))
+	}
+	return "", fmt.Errorf("no archive for %s %s found in %s, tried: %s", tool, version, mirror, strings.Join(tried, ", "))
+}
+
+// ListInstalledTools returns every tool version in the managed toolchain
+// directory, sorted by name and version
+func ListInstalledTools() ([]InstalledTool, error) {
+	toolchainDir, err := ToolchainDir()
+	if err != nil {
+		return nil, err
+	}
+	toolEntries, err := os.ReadDir(toolchainDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading toolchain directory: %v", err)
+	}
+
+	var installed []InstalledTool
+	for _, toolEntry := range toolEntries {
+		if !toolEntry.IsDir() || strings.HasPrefix(toolEntry.Name(), ".") {
+			continue
+		}
+		versionEntries, err := os.ReadDir(filepath.Join(toolchainDir, toolEntry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading toolchain directory: %v", err)
+		}
+		for _, versionEntry := range versionEntries {
+			if !versionEntry.IsDir() || strings.HasPrefix(versionEntry.Name(), ".") {
+				continue
+			}
+			installed = append(installed, InstalledTool{
+				Name:    toolEntry.Name(),
+				Version: versionEntry.Name(),
+				Dir:     filepath.Join(toolchainDir, toolEntry.Name(), versionEntry.Name()),
+			})
+		}
+	}
+
+	sort.Slice(installed, func(i, j int) bool {
+		if installed[i].Name != installed[j].Name {
+			return installed[i].Name < installed[j].Name
+		}
+		return compareVersions(installed[i].Version, installed[j].Version) < 0
+	})
+	return installed, nil
+}
+
+// compareVersions orders version strings numerically, so 25.10 comes after
+// 25.9, falling back to comparing them as strings when they are equal as
+// versions or do not parse
+func compareVersions(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	if errA == nil && errB == nil {
+		if c := va.Compare(vb); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Keeps reports whether an installed tool version satisfies the tool's
+// pinned constraint, exact or a range, so pruning must keep it
+func (t Toolchain) Keeps(tool InstalledTool) bool {
+	constraint := t.Constraint(tool.Name)
+	if constraint == "" {
+		return false
+	}
+	ok, err := MatchConstraint(constraint, tool.Version)
+	return err == nil && ok
+}
+
+// RemoveInstalledTool deletes an installed tool version
+func RemoveInstalledTool(tool InstalledTool) error {
+	if err := os.RemoveAll(tool.Dir); err != nil {
+		return fmt.Errorf("error removing %s %s: %v", tool.Name, tool.Version, err)
+	}
+	// Drop the tool directory once its last version is gone
+	parent := filepath.Dir(tool.Dir)
+	if entries, err := os.ReadDir(parent); err == nil && len(entries) == 0 {
+		os.Remove(parent)
+	}
+	return nil
+}
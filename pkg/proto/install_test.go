@@ -0,0 +1,322 @@
+package proto
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTarGz writes a .tar.gz archive holding files. Names ending in a
+// script shebang are stored as executables.
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		mode := int64(0644)
+		if strings.HasPrefix(content, "#!") {
+			mode = 0755
+		}
+		header := &tar.Header{Name: name, Mode: mode, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write tar entry: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to close gzip writer: %v", err)
+	}
+}
+
+// writeZip writes a .zip archive holding files
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(0644)
+		if strings.HasPrefix(content, "#!") {
+			header.SetMode(0755)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close zip writer: %v", err)
+	}
+}
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name  string
+		entry string
+		write func(*testing.T, string, map[string]string)
+	}{
+		{name: "tar parent", entry: "../evil.proto", write: writeTarGz},
+		{name: "tar nested parent", entry: "a/../../evil.proto", write: writeTarGz},
+		{name: "tar absolute", entry: "/tmp/evil.proto", write: writeTarGz},
+		{name: "zip parent", entry: "../evil.proto", write: writeZip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(tempDir, "archive")
+			tt.write(t, archive, map[string]string{tt.entry: "syntax = \"proto3\";"})
+			dest := filepath.Join(tempDir, "out", "dest")
+			if err := ExtractArchive(archive, dest); err == nil {
+				t.Errorf("ExtractArchive() error = nil, want error for %q", tt.entry)
+			}
+			if _, err := os.Stat(filepath.Join(tempDir, "out", "evil.proto")); err == nil {
+				t.Errorf("ExtractArchive() wrote a file outside the destination")
+			}
+		})
+	}
+}
+
+func TestInstallFromMirror(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	// A local directory acts as the mirror
+	mirror := filepath.Join(tempDir, "mirror")
+	if err := os.MkdirAll(mirror, 0755); err != nil {
+		t.Fatalf("Failed to create mirror: %v", err)
+	}
+	protocNames := MirrorArchiveNames("protoc", "25.1")
+	writeTarGz(t, filepath.Join(mirror, protocNames[0]), map[string]string{
+		"bin/protoc":                        "#!/bin/sh\necho 'libprotoc 25.1'\n",
+		"include/google/protobuf/any.proto": "syntax = \"proto3\";",
+	})
+	pluginNames := MirrorArchiveNames("protoc-gen-go", "1.34.2")
+	writeZip(t, filepath.Join(mirror, pluginNames[2]), map[string]string{
+		"protoc-gen-go": "#!/bin/sh\necho 'protoc-gen-go v1.34.2'\n",
+	})
+
+	toolchain := Toolchain{
+		Protoc:  "25.1",
+		Plugins: map[string]string{"protoc-gen-go": "=1.34.2", "protoc-gen-go-grpc": "^1.3"},
+		Mirror:  mirror,
+	}
+	for _, tool := range []string{"protoc", "protoc-gen-go"} {
+		version, _ := ExactVersion(toolchain.Constraint(tool))
+		if _, err := InstallFromMirror(tool, version, mirror); err != nil {
+			t.Fatalf("InstallFromMirror(%s) error = %v", tool, err)
+		}
+	}
+	if _, err := InstallFromMirror("protoc-gen-go-grpc", "1.3.0", mirror); err == nil {
+		t.Error("InstallFromMirror() error = nil, want error for missing archive")
+	}
+
+	protoc, err := toolchain.LookPath("protoc")
+	if err != nil {
+		t.Fatalf("LookPath() error = %v", err)
+	}
+	if !strings.HasPrefix(protoc, filepath.Join(tempDir, "cache", "toolchain")) {
+		t.Errorf("LookPath() = %s, want managed protoc", protoc)
+	}
+	if version, err := ToolVersion(protoc); err != nil || version != "25.1" {
+		t.Errorf("ToolVersion() = %q, %v, want 25.1", version, err)
+	}
+	if toolchain.ManagedIncludeDir() == "" {
+		t.Error("ManagedIncludeDir() = \"\", want protoc include directory")
+	}
+	if dirs := toolchain.ManagedBinDirs(); len(dirs) != 2 {
+		t.Errorf("ManagedBinDirs() = %v, want 2 directories", dirs)
+	}
+
+	installed, err := ListInstalledTools()
+	if err != nil {
+		t.Fatalf("ListInstalledTools() error = %v", err)
+	}
+	if len(installed) != 2 || installed[0].Name != "protoc" || installed[1].Version != "1.34.2" {
+		t.Fatalf("ListInstalledTools() = %+v, want protoc 25.1 and protoc-gen-go 1.34.2", installed)
+	}
+
+	if err := RemoveInstalledTool(installed[0]); err != nil {
+		t.Fatalf("RemoveInstalledTool() error = %v", err)
+	}
+	if _, ok := ManagedToolPath("protoc", "25.1"); ok {
+		t.Error("ManagedToolPath() found protoc after removal")
+	}
+}
+
+func TestDownloadFileTimeout(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A server that accepts the request but never answers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	originalTimeout := downloadTimeout
+	downloadTimeout = 100 * time.Millisecond
+	defer func() { downloadTimeout = originalTimeout }()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- DownloadFile(server.URL+"/protoc.tar.gz", filepath.Join(tempDir, "protoc.tar.gz"))
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("DownloadFile() error = nil, want a timeout")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("DownloadFile() did not time out")
+	}
+}
+
+func TestListInstalledToolsOrder(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", tempDir)
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	for _, dir := range []string{"protoc/25.10", "protoc/25.9", "protoc/3.21.12", "protoc/25.1", "protoc-gen-go/1.34.2"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, "toolchain", filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	installed, err := ListInstalledTools()
+	if err != nil {
+		t.Fatalf("ListInstalledTools() error = %v", err)
+	}
+	var got []string
+	for _, tool := range installed {
+		got = append(got, tool.Name+" "+tool.Version)
+	}
+	want := []string{"protoc 3.21.12", "protoc 25.1", "protoc 25.9", "protoc 25.10", "protoc-gen-go 1.34.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListInstalledTools() = %v, want %v", got, want)
+	}
+
+	// Versions in a pinned range are kept as well as an exact pin
+	toolchain := Toolchain{Protoc: ">=25.9 <26"}
+	for _, tool := range installed {
+		keep := tool.Name == "protoc" && (tool.Version == "25.9" || tool.Version == "25.10")
+		if toolchain.Keeps(tool) != keep {
+			t.Errorf("Keeps(%s %s) = %v, want %v", tool.Name, tool.Version, !keep, keep)
+		}
+	}
+	if toolchain := (Toolchain{Protoc: "25.1"}); !toolchain.Keeps(installed[1]) || toolchain.Keeps(installed[2]) {
+		t.Error("Keeps() with an exact pin does not keep exactly that version")
+	}
+}
+
+func TestExactVersion(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       string
+		ok         bool
+	}{
+		{constraint: "25.1", want: "25.1", ok: true},
+		{constraint: "=1.34.2", want: "1.34.2", ok: true},
+		{constraint: "v1.34.2", want: "1.34.2", ok: true},
+		{constraint: "^1.3", ok: false},
+		{constraint: ">=25 <26", ok: false},
+		{constraint: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ExactVersion(tt.constraint)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ExactVersion(%q) = %q, %v, want %q, %v", tt.constraint, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInstallToolRejectsUnsafeNames(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	archive := filepath.Join(tempDir, "protoc.tar.gz")
+	writeTarGz(t, archive, map[string]string{"bin/protoc": "#!/bin/sh\necho 'libprotoc 25.1'\n"})
+	victim := filepath.Join(tempDir, "cache", "keep")
+	writeFiles(t, victim, map[string]string{"file.txt": "keep"})
+
+	tests := []struct {
+		tool    string
+		version string
+	}{
+		{tool: "protoc", version: "../../keep"},
+		{tool: "protoc", version: ".."},
+		{tool: "protoc", version: "25.1/.."},
+		{tool: "protoc", version: "^25"},
+		{tool: "..", version: "25.1"},
+		{tool: "../keep", version: "25.1"},
+		{tool: "", version: "25.1"},
+	}
+	for _, tt := range tests {
+		if _, err := InstallTool(tt.tool, tt.version, archive); err == nil {
+			t.Errorf("InstallTool(%q, %q) succeeded, want an error", tt.tool, tt.version)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(victim, "file.txt")); err != nil {
+		t.Errorf("file outside the toolchain directory was removed: %v", err)
+	}
+
+	if !(Toolchain{}).KnownTool("protoc-gen-mypy") || (Toolchain{}).KnownTool("rm") {
+		t.Error("KnownTool() does not match the tools run by gen")
+	}
+	if !(Toolchain{Plugins: map[string]string{"protoc-gen-validate": "1.0"}}).KnownTool("protoc-gen-validate") {
+		t.Error("KnownTool() does not accept a pinned plugin")
+	}
+}
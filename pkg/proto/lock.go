@@ -0,0 +1,104 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// lockTimeout is how long to wait for another process to release a lock. A
+// live holder keeps its lock fresh, so this only needs to cover the slowest
+// operation done under a lock, such as the first clone of a large repository.
+var lockTimeout = 30 * time.Minute
+
+// staleLockAge is the age after which a lock is assumed to belong to a
+// process that died without releasing it
+const staleLockAge = time.Minute
+
+// lockRefreshInterval is how often a held lock's modification time is
+// updated to show its holder is still alive
+var lockRefreshInterval = staleLockAge / 4
+
+// acquireLock takes an exclusive lock by creating path, waiting up to timeout
+// for another holder to release it. It returns a function that releases the
+// lock. A lock file is used rather than flock so it works the same on every
+// platform and filesystem. The file records the holder's PID and host, and is
+// touched periodically while held, so a lock that has not been touched for
+// staleLockAge was left behind by a process that died.
+func acquireLock(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(f, "%d %s\n", os.Getpid(), host)
+			f.Close()
+			return refreshLock(path), nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("error creating lock file %s: %v", path, err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			// The holder is gone; remove its lock and try again
+			breakStaleLock(path, info)
+			continue
+		}
+		if time.Now().After(deadline) {
+			holder := "another process"
+			if data, err := os.ReadFile(path); err == nil {
+				if fields := strings.Fields(string(data)); len(fields) == 2 {
+					holder = fmt.Sprintf("process %s on %s", fields[0], fields[1])
+				} else if len(fields) == 1 {
+					holder = "process " + fields[0]
+				}
+			}
+			return nil, fmt.Errorf("timed out waiting for lock %s held by %s; if it is no longer running, remove the lock", path, holder)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// breakStaleLock removes the lock at path that was found stale. Another
+// waiter may have seen the same stale lock, broken it and taken the lock
+// since, so rather than removing path directly the lock is renamed aside and
+// only removed if it is still the stale file; a fresh lock is put back.
+func breakStaleLock(path string, stale os.FileInfo) {
+	aside := fmt.Sprintf("%s.stale-%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if info, err := os.Stat(aside); err == nil && (!os.SameFile(info, stale) || time.Since(info.ModTime()) <= staleLockAge) {
+		// Linking fails rather than replacing a lock taken in the meantime
+		os.Link(aside, path)
+	}
+	os.Remove(aside)
+}
+
+// refreshLock keeps the lock at path fresh until the returned function is
+// called, which stops refreshing and releases it
+func refreshLock(path string) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(lockRefreshInterval)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				os.Chtimes(path, now, now)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		os.Remove(path)
+	}
+}
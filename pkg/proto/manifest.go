@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GenManifest records how the contents of the build directory were generated
+type GenManifest struct {
+	Targets map[string]GenTarget `yaml:"targets"`
+}
+
+// GenTarget records a single generation run for one SDK type
+type GenTarget struct {
+	Toolchain map[string]string `yaml:"toolchain"`
+}
+
+// getGenManifestPath returns the path to the generation manifest
+func getGenManifestPath(buildDir string) string {
+	return filepath.Join(buildDir, ".proto_gen.yaml")
+}
+
+// LoadGenManifest loads the generation manifest from the build directory
+func LoadGenManifest(buildDir string) (*GenManifest, error) {
+	manifest := &GenManifest{Targets: map[string]GenTarget{}}
+	data, err := os.ReadFile(getGenManifestPath(buildDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, fmt.Errorf("error reading generation manifest: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error parsing generation manifest: %v", err)
+	}
+	if manifest.Targets == nil {
+		manifest.Targets = map[string]GenTarget{}
+	}
+	return manifest, nil
+}
+
+// SaveGenManifest saves the generation manifest to the build directory
+func SaveGenManifest(buildDir string, manifest *GenManifest) error {
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("error marshaling generation manifest: %v", err)
+	}
+	if err := os.WriteFile(getGenManifestPath(buildDir), data, 0644); err != nil {
+		return fmt.Errorf("error writing generation manifest: %v", err)
+	}
+	return nil
+}
+
+// RecordToolchain stores the resolved tool versions for a target
+func (m *GenManifest) RecordToolchain(target string, statuses []ToolStatus) {
+	versions := map[string]string{}
+	for _, status := range statuses {
+		version := status.Version
+		if version == "" {
+			version = "unknown"
+		}
+		if status.Path == "" {
+			version = "not installed"
+		}
+		versions[status.Name] = version
+	}
+	entry := m.Targets[target]
+	entry.Toolchain = versions
+	m.Targets[target] = entry
+}
@@ -0,0 +1,153 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the .protorc format written by this version of proto
+const CurrentConfigVersion = 1
+
+// migration upgrades a .protorc document from one format version to the next.
+// Migrations work on the YAML tree so that keys the current Config no longer
+// knows about can still be read, and comments survive an on-disk upgrade.
+type migration struct {
+	from        int
+	description string
+	apply       func(root *yaml.Node, state *migrationState) error
+}
+
+// migrationState carries values that migrations move out of .protorc
+type migrationState struct {
+	gitHead string
+}
+
+// migrations lists every format upgrade in order
+var migrations = []migration{
+	{
+		from:        0,
+		description: "move gitHead from .protorc to the .proto_cache file in proto_dir",
+		apply: func(root *yaml.Node, state *migrationState) error {
+			for _, key := range []string{"gitHead", "git_head"} {
+				if value := mappingValue(root, key); value != nil {
+					if value.Kind != yaml.ScalarNode {
+						return fmt.Errorf("%s must be a string", key)
+					}
+					state.gitHead = value.Value
+					removeKey(root, []string{key})
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// configVersion reads the format version of a .protorc document. Files
+// written before versioning was introduced have no version key and are 0.
+func configVersion(root *yaml.Node) (int, error) {
+	value := mappingValue(root, "version")
+	if value == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(value.Value)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("line %d: version must be a non-negative integer", value.Line)
+	}
+	if version > CurrentConfigVersion {
+		return 0, fmt.Errorf("config version %d is newer than this proto supports (%d), please upgrade proto", version, CurrentConfigVersion)
+	}
+	return version, nil
+}
+
+// migrateNode upgrades a .protorc document in place to the current version,
+// returning the descriptions of the migrations applied
+func migrateNode(root *yaml.Node, state *migrationState) ([]string, error) {
+	version, err := configVersion(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		if m.from < version {
+			continue
+		}
+		if err := m.apply(root, state); err != nil {
+			return nil, fmt.Errorf("error migrating config from version %d: %v", m.from, err)
+		}
+		applied = append(applied, m.description)
+		version = m.from + 1
+	}
+	if len(applied) > 0 {
+		setVersion(root, version)
+	}
+	return applied, nil
+}
+
+// setVersion writes the version key, placing it first in a new document
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if existing := mappingValue(root, "version"); existing != nil {
+		existing.Value = value
+		existing.Tag = "!!int"
+		return
+	}
+	root.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: value},
+	}, root.Content...)
+}
+
+// Migrations returns the migrations applied in memory when the config was
+// loaded. A non-empty result means the file on disk is out of date.
+func (c *Config) Migrations() []string {
+	return c.migrations
+}
+
+// MigrateConfigFile upgrades a .protorc file on disk to the current version,
+// moving legacy values such as gitHead into the cache file. It returns the
+// descriptions of the migrations applied.
+func MigrateConfigFile(configPath string) ([]string, error) {
+	root, err := readConfigNode(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var state migrationState
+	applied, err := migrateNode(root, &state)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	data, err := encodeNode(root)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling config: %v", err)
+	}
+	config, err := parseConfig(data, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the legacy head unless the cache already has a newer one
+	if state.gitHead != "" {
+		cached, err := LoadCache(config)
+		if err != nil {
+			return nil, err
+		}
+		if cached.GitHead == "" && cached.ContentHash == "" {
+			if err := SaveCache(config, SyncState{GitHead: state.gitHead}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("error writing config file: %v", err)
+	}
+	return applied, nil
+}
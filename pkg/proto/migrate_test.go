@@ -0,0 +1,126 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyFixture copies a .protorc fixture from testdata into dir
+func copyFixture(t *testing.T, name, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "protorc", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", name, err)
+	}
+	configPath := filepath.Join(dir, ".protorc")
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+	return configPath
+}
+
+func TestLoadHistoricalConfigs(t *testing.T) {
+	tests := []struct {
+		fixture        string
+		wantMigrations int
+		wantGitHead    string
+	}{
+		{fixture: "v0-githead.yaml", wantMigrations: 1, wantGitHead: "abc123"},
+		{fixture: "v0.yaml", wantMigrations: 1},
+		{fixture: "v1.yaml", wantMigrations: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "proto-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+
+			config, err := ReadConfig(copyFixture(t, tt.fixture, tempDir))
+			if err != nil {
+				t.Fatalf("ReadConfig() error = %v", err)
+			}
+			if config.Version != CurrentConfigVersion {
+				t.Errorf("Version = %d, want %d", config.Version, CurrentConfigVersion)
+			}
+			if config.GitHubURL != "https://github.com/example/proto-files" || config.RemotePath != "api/proto" {
+				t.Errorf("ReadConfig() = %+v, want fixture values", config)
+			}
+			if len(config.Migrations()) != tt.wantMigrations {
+				t.Errorf("Migrations() = %v, want %d", config.Migrations(), tt.wantMigrations)
+			}
+
+			state, err := LoadCache(config)
+			if err != nil {
+				t.Fatalf("LoadCache() error = %v", err)
+			}
+			if state.GitHead != tt.wantGitHead {
+				t.Errorf("LoadCache() git head = %q, want %q", state.GitHead, tt.wantGitHead)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := copyFixture(t, "v0-githead.yaml", tempDir)
+	applied, err := MigrateConfigFile(configPath)
+	if err != nil {
+		t.Fatalf("MigrateConfigFile() error = %v", err)
+	}
+	if len(applied) != 1 {
+		t.Errorf("MigrateConfigFile() applied %v, want 1 migration", applied)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read .protorc: %v", err)
+	}
+	content := string(data)
+	if !strings.HasPrefix(content, "version: 1\n") {
+		t.Errorf(".protorc = %q, want it to start with the version", content)
+	}
+	if strings.Contains(content, "gitHead") {
+		t.Errorf(".protorc = %q, want gitHead removed", content)
+	}
+	if !strings.Contains(content, "# Written by proto v0.1") {
+		t.Errorf(".protorc = %q, want comments kept", content)
+	}
+
+	// The head now lives in the cache file
+	cache, err := os.ReadFile(filepath.Join(tempDir, "proto", ".proto_cache"))
+	if err != nil || !strings.Contains(string(cache), "abc123") {
+		t.Errorf("cache file = %q, %v, want git_head abc123", cache, err)
+	}
+
+	// A second run has nothing to do
+	applied, err = MigrateConfigFile(configPath)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("MigrateConfigFile() = %v, %v, want no migrations", applied, err)
+	}
+}
+
+func TestConfigFromNewerVersion(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, ".protorc")
+	if err := os.WriteFile(configPath, []byte("version: 99\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+	if _, err := ReadConfig(configPath); err == nil || !strings.Contains(err.Error(), "upgrade proto") {
+		t.Errorf("ReadConfig() error = %v, want an upgrade hint", err)
+	}
+}
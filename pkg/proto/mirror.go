@@ -0,0 +1,91 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unsafeNameChars matches characters not kept in mirror directory names
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// mirrorCacheDir returns the directory bare mirrors are cached in
+func mirrorCacheDir() (string, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "mirrors"), nil
+}
+
+// mirrorPath returns the bare mirror directory for a repository URL. The
+// name keeps the repository's base name for readability, plus a hash of the
+// whole URL so different repositories never share a mirror.
+func mirrorPath(repoURL string) (string, error) {
+	dir, err := mirrorCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(RedactURL(repoURL)))
+	base := strings.TrimSuffix(path.Base(strings.TrimRight(filepath.ToSlash(repoURL), "/")), ".git")
+	base = strings.Trim(unsafeNameChars.ReplaceAllString(base, "-"), "-.")
+	if base == "" {
+		base = "repo"
+	}
+	return filepath.Join(dir, base+"-"+hex.EncodeToString(sum[:8])+".git"), nil
+}
+
+// updateMirror makes sure a bare mirror of repoURL exists in the cache and,
+// unless offline, fetches the latest refs into it. It returns the mirror's
+// path and a function releasing the lock that keeps concurrent syncs from
+// updating the same mirror at once; the lock must be held while reading from
+// the mirror.
+func updateMirror(git *Git, repoURL string, offline bool) (string, func(), error) {
+	mirror, err := mirrorPath(repoURL)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(mirror), 0755); err != nil {
+		return "", nil, fmt.Errorf("error creating mirror cache: %v", err)
+	}
+	unlock, err := acquireLock(mirror+".lock", lockTimeout)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, statErr := os.Stat(mirror)
+	switch {
+	case os.IsNotExist(statErr) && offline:
+		unlock()
+		return "", nil, fmt.Errorf("no cached mirror of %s; run 'proto sync' without --offline first", RedactURL(repoURL))
+	case os.IsNotExist(statErr):
+		// Clone next to the final location and rename, so an interrupted
+		// clone never looks like a usable mirror
+		staging := mirror + ".tmp"
+		os.RemoveAll(staging)
+		if _, err := git.Run("clone", "--mirror", "--quiet", repoURL, staging); err != nil {
+			os.RemoveAll(staging)
+			unlock()
+			return "", nil, &CloneError{URL: repoURL, Err: err}
+		}
+		if err := os.Rename(staging, mirror); err != nil {
+			os.RemoveAll(staging)
+			unlock()
+			return "", nil, fmt.Errorf("error caching mirror: %v", err)
+		}
+	case statErr != nil:
+		unlock()
+		return "", nil, fmt.Errorf("error reading mirror cache: %v", statErr)
+	case !offline:
+		if _, err := git.Run("--git-dir", mirror, "fetch", "--prune", "--quiet", repoURL, "+refs/*:refs/*"); err != nil {
+			unlock()
+			return "", nil, &CloneError{URL: repoURL, Err: err}
+		}
+	}
+	return mirror, unlock, nil
+}
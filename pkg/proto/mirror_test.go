@@ -0,0 +1,163 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncMirror(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	bare, work := createRepo(t, tempDir, map[string]string{"protos/service.proto": "syntax = \"proto3\";\n"})
+	repoURL := "file://" + bare
+	newConfig := func(protoDir string) *Config {
+		return &Config{
+			GitHubURL:  repoURL,
+			Branch:     "main",
+			RemotePath: "protos",
+			ProtoDir:   protoDir,
+			path:       filepath.Join(tempDir, ConfigFileName),
+		}
+	}
+
+	// Offline sync needs a mirror to exist
+	if _, err := Sync(newConfig("./proto-a"), SyncOptions{Offline: true}); err == nil || !strings.Contains(err.Error(), "--offline") {
+		t.Fatalf("offline Sync() error = %v, want a missing mirror error", err)
+	}
+
+	if _, err := Sync(newConfig("./proto-a"), SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	mirror, err := mirrorPath(repoURL)
+	if err != nil {
+		t.Fatalf("mirrorPath() error = %v", err)
+	}
+	if out := runGit(t, tempDir, "--git-dir", mirror, "rev-parse", "--is-bare-repository"); out != "true" {
+		t.Errorf("mirror is not a bare repository: %s", out)
+	}
+	if _, err := os.Stat(mirror + ".lock"); !os.IsNotExist(err) {
+		t.Error("Sync() left the mirror locked")
+	}
+
+	// A new upstream commit is only seen once the mirror is fetched
+	head := commitFiles(t, work, bare, "add message", map[string]string{"protos/message.proto": "syntax = \"proto3\";\n"})
+	result, err := Sync(newConfig("./proto-b"), SyncOptions{Offline: true})
+	if err != nil {
+		t.Fatalf("offline Sync() error = %v", err)
+	}
+	if result.Revision == head || len(result.Files) != 1 {
+		t.Errorf("offline Sync() = %+v, want the cached revision", result)
+	}
+	result, err = Sync(newConfig("./proto-b"), SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.Revision != head || len(result.Files) != 2 {
+		t.Errorf("Sync() = %+v, want revision %s with both files", result, head)
+	}
+
+	// With the upstream gone, offline syncs still work from the mirror
+	if err := os.RemoveAll(bare); err != nil {
+		t.Fatalf("Failed to remove upstream: %v", err)
+	}
+	result, err = Sync(newConfig("./proto-c"), SyncOptions{Offline: true})
+	if err != nil {
+		t.Fatalf("offline Sync() error = %v", err)
+	}
+	if result.Revision != head {
+		t.Errorf("offline Sync() revision = %s, want %s", result.Revision, head)
+	}
+	if _, err := Sync(newConfig("./proto-c"), SyncOptions{}); err == nil {
+		t.Error("Sync() error = nil, want an error fetching a missing upstream")
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	lockPath := filepath.Join(tempDir, "mirror.lock")
+
+	unlock, err := acquireLock(lockPath, time.Second)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+	if _, err := acquireLock(lockPath, 200*time.Millisecond); err == nil {
+		t.Fatal("second acquireLock() error = nil, want a timeout")
+	}
+
+	// The lock is handed over once it is released
+	release := unlock
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		release()
+	}()
+	unlock, err = acquireLock(lockPath, 5*time.Second)
+	if err != nil {
+		t.Fatalf("acquireLock() after release error = %v", err)
+	}
+	unlock()
+
+	// A lock left behind by a dead process is taken over
+	if err := os.WriteFile(lockPath, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("Failed to age lock: %v", err)
+	}
+	stale, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatalf("Failed to stat lock: %v", err)
+	}
+	unlock, err = acquireLock(lockPath, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("acquireLock() with stale lock error = %v", err)
+	}
+
+	// A second waiter that saw the same stale lock leaves the new one alone
+	breakStaleLock(lockPath, stale)
+	if data, err := os.ReadFile(lockPath); err != nil || !strings.HasPrefix(string(data), fmt.Sprintf("%d ", os.Getpid())) {
+		t.Errorf("lock after breaking a stale lock again = %q, %v, want the new holder", data, err)
+	}
+	if _, err := acquireLock(lockPath, 200*time.Millisecond); err == nil {
+		t.Error("acquireLock() of a taken over lock error = nil, want a timeout")
+	}
+	unlock()
+	if leftovers, _ := filepath.Glob(lockPath + ".stale-*"); len(leftovers) != 0 {
+		t.Errorf("stale locks left behind: %v", leftovers)
+	}
+
+	// A lock held longer than staleLockAge is kept fresh by its holder
+	originalInterval := lockRefreshInterval
+	lockRefreshInterval = 20 * time.Millisecond
+	defer func() { lockRefreshInterval = originalInterval }()
+	unlock, err = acquireLock(lockPath, time.Second)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+	defer unlock()
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("Failed to age lock: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_, err = acquireLock(lockPath, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("held by process %d", os.Getpid())) {
+		t.Errorf("acquireLock() of a refreshed lock error = %v, want a timeout naming this process", err)
+	}
+}
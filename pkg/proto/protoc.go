@@ -0,0 +1,96 @@
+package proto
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProtocArgLimit bounds the bytes of arguments passed to a single protoc run,
+// safely below the smallest command line limit of the supported platforms
+// (32K characters on Windows)
+const ProtocArgLimit = 24 * 1024
+
+// ChunkFiles splits files into batches that can each be passed to protoc
+// along with args without the command line exceeding limit bytes. Every
+// batch holds at least one file, so a single file longer than the limit
+// still gets a batch of its own.
+func ChunkFiles(args, files []string, limit int) [][]string {
+	reserved := 0
+	for _, arg := range args {
+		reserved += len(arg) + 1
+	}
+
+	var batches [][]string
+	var batch []string
+	size := reserved
+	for _, file := range files {
+		if len(batch) > 0 && size+len(file)+1 > limit {
+			batches = append(batches, batch)
+			batch, size = nil, reserved
+		}
+		batch = append(batch, file)
+		size += len(file) + 1
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// ProtocError is a problem protoc reported in a proto file
+type ProtocError struct {
+	// File is the input file the problem is in, or the path protoc reported
+	// if it is not one of the inputs, such as an imported file
+	File string
+	// Line and Column are 0 when protoc reports no position
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e ProtocError) String() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// protocErrorPattern matches a protoc diagnostic naming a proto file, with
+// or without a position, e.g. "api/service.proto:12:5: Expected \";\"." or
+// "Could not make proto path relative: api/user.proto: No such file"
+var protocErrorPattern = regexp.MustCompile(`(?:^|\s)([^\s:]+\.proto)(?::(\d+):(\d+))?: (.*)$`)
+
+// ParseProtocErrors extracts the problems protoc reported in its output and
+// maps each one back to the input file it refers to. protoc names files by
+// their path relative to the include path, so an input matches when its path
+// ends with the reported one; the shortest such input is the one directly
+// under the include path. Lines that name no proto file are skipped.
+func ParseProtocErrors(output string, files []string) []ProtocError {
+	var problems []ProtocError
+	for _, line := range strings.Split(output, "\n") {
+		m := protocErrorPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		problem := ProtocError{File: m[1], Message: m[4]}
+		problem.Line, _ = strconv.Atoi(m[2])
+		problem.Column, _ = strconv.Atoi(m[3])
+
+		reported := filepath.ToSlash(m[1])
+		matched := ""
+		for _, file := range files {
+			slashed := filepath.ToSlash(file)
+			if (slashed == reported || strings.HasSuffix(slashed, "/"+reported)) && (matched == "" || len(file) < len(matched)) {
+				matched = file
+			}
+		}
+		if matched != "" {
+			problem.File = matched
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
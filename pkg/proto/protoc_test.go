@@ -0,0 +1,59 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChunkFiles(t *testing.T) {
+	args := []string{"--python_out=gen", "-I", "proto"} // 26 bytes with separators
+	files := []string{"proto/a.proto", "proto/b.proto", "proto/c.proto", "proto/long/name.proto"}
+
+	if got := ChunkFiles(args, files, ProtocArgLimit); !reflect.DeepEqual(got, [][]string{files}) {
+		t.Errorf("ChunkFiles() = %v, want a single batch", got)
+	}
+
+	// Room for two of the short files after the fixed arguments
+	want := [][]string{
+		{"proto/a.proto", "proto/b.proto"},
+		{"proto/c.proto"},
+		{"proto/long/name.proto"},
+	}
+	if got := ChunkFiles(args, files, 26+28); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChunkFiles() = %v, want %v", got, want)
+	}
+
+	// A file that cannot fit still gets a batch
+	if got := ChunkFiles(args, files[:2], 10); !reflect.DeepEqual(got, [][]string{{"proto/a.proto"}, {"proto/b.proto"}}) {
+		t.Errorf("ChunkFiles() over the limit = %v, want one file per batch", got)
+	}
+	if got := ChunkFiles(args, nil, ProtocArgLimit); got != nil {
+		t.Errorf("ChunkFiles() without files = %v, want none", got)
+	}
+}
+
+func TestParseProtocErrors(t *testing.T) {
+	files := []string{"proto/service.proto", "proto/api/service.proto", "proto/user.proto"}
+	output := `service.proto:12:5: Expected ";".
+api/service.proto:3:1: "User" is not defined.
+Could not make proto path relative: proto/user.proto: No such file or directory
+google/api/annotations.proto: File not found.
+--grpc_python_out: protoc-gen-grpc_python: Plugin failed with status code 1.
+`
+	want := []ProtocError{
+		{File: "proto/service.proto", Line: 12, Column: 5, Message: `Expected ";".`},
+		{File: "proto/api/service.proto", Line: 3, Column: 1, Message: `"User" is not defined.`},
+		{File: "proto/user.proto", Message: "No such file or directory"},
+		{File: "google/api/annotations.proto", Message: "File not found."},
+	}
+	got := ParseProtocErrors(output, files)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseProtocErrors() = %+v, want %+v", got, want)
+	}
+	if s := got[0].String(); s != `proto/service.proto:12:5: Expected ";".` {
+		t.Errorf("String() = %q", s)
+	}
+	if s := got[2].String(); s != "proto/user.proto: No such file or directory" {
+		t.Errorf("String() without a position = %q", s)
+	}
+}
@@ -0,0 +1,324 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProvenanceFileName is the file in each synced directory recording where
+// every file came from
+const ProvenanceFileName = ".proto_manifest.yaml"
+
+// Provenance lists the files synced into a directory and where each came from
+type Provenance struct {
+	Files []FileProvenance `yaml:"files"`
+}
+
+// FileProvenance records the origin of one synced file
+type FileProvenance struct {
+	// File is the path relative to the synced directory, in slash form
+	File string `yaml:"file"`
+	// Source is the repository URL, path or archive URL, without credentials
+	Source string `yaml:"source"`
+	// Commit is the synced commit, empty for sources without one
+	Commit string `yaml:"commit,omitempty"`
+	// Path is the file's path inside the source
+	Path string `yaml:"path"`
+	// SHA256 is the digest of the file as synced
+	SHA256   string    `yaml:"sha256"`
+	SyncedAt time.Time `yaml:"synced_at"`
+}
+
+// Lookup returns the provenance of a file relative to the synced directory
+func (p *Provenance) Lookup(file string) (FileProvenance, bool) {
+	for _, entry := range p.Files {
+		if entry.File == file {
+			return entry, true
+		}
+	}
+	return FileProvenance{}, false
+}
+
+// LoadProvenance reads the provenance manifest of a synced directory. A
+// missing manifest yields nil.
+func LoadProvenance(dir string) (*Provenance, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ProvenanceFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading provenance manifest: %v", err)
+	}
+	var provenance Provenance
+	if err := yaml.Unmarshal(data, &provenance); err != nil {
+		return nil, fmt.Errorf("error parsing provenance manifest: %v", err)
+	}
+	return &provenance, nil
+}
+
+// writeProvenance saves the provenance manifest of a synced directory, with
+// the files sorted so the manifest diffs cleanly
+func writeProvenance(dir string, provenance *Provenance) error {
+	sort.Slice(provenance.Files, func(i, j int) bool {
+		return provenance.Files[i].File < provenance.Files[j].File
+	})
+	data, err := yaml.Marshal(provenance)
+	if err != nil {
+		return fmt.Errorf("error marshaling provenance manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ProvenanceFileName), data, 0644); err != nil {
+		return fmt.Errorf("error writing provenance manifest: %v", err)
+	}
+	return nil
+}
+
+// upstreamPrefix returns the directory inside a source that synced file
+// paths are relative to
+func upstreamPrefix(source Source) string {
+	prefix := path.Join(filepath.ToSlash(source.Archive.StripPrefix), filepath.ToSlash(source.Archive.Subpath), filepath.ToSlash(strings.Trim(source.RemotePath, `"'`)))
+	if prefix == "." {
+		return ""
+	}
+	return strings.Trim(prefix, "/")
+}
+
+// newProvenance builds the manifest for files synced from source at
+// revision, given each file's sha256
+func newProvenance(source Source, revision string, digests map[string]string) *Provenance {
+	now := time.Now().UTC().Truncate(time.Second)
+	prefix := upstreamPrefix(source)
+	provenance := &Provenance{}
+	for file, digest := range digests {
+		provenance.Files = append(provenance.Files, FileProvenance{
+			File:     file,
+			Source:   sourceLocation(source),
+			Commit:   revision,
+			Path:     path.Join(prefix, file),
+			SHA256:   digest,
+			SyncedAt: now,
+		})
+	}
+	return provenance
+}
+
+// digestFiles returns the sha256 of each of files under dir
+func digestFiles(dir string, files []string) (map[string]string, error) {
+	digests := map[string]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading proto file %s: %v", file, err)
+		}
+		sum := sha256.Sum256(data)
+		digests[file] = hex.EncodeToString(sum[:])
+	}
+	return digests, nil
+}
+
+// localChanges compares the files a sync would write, given their new
+// digests, against destDir. edited lists files whose content differs both
+// from what the last sync wrote and from the new content, so writing them
+// would lose local work; files not written by the last sync count as edited
+// too. missing lists files the last sync wrote that have since been deleted.
+// Without a provenance manifest nothing is reported.
+func localChanges(destDir string, digests map[string]string) ([]string, []string, error) {
+	provenance, err := LoadProvenance(destDir)
+	if err != nil || provenance == nil {
+		return nil, nil, err
+	}
+	var edited, missing []string
+	for file, digest := range digests {
+		recorded, tracked := provenance.Lookup(file)
+		data, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(file)))
+		if os.IsNotExist(err) {
+			if tracked {
+				missing = append(missing, file)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading proto file %s: %v", file, err)
+		}
+		sum := sha256.Sum256(data)
+		local := hex.EncodeToString(sum[:])
+		if local != digest && (!tracked || local != recorded.SHA256) {
+			edited = append(edited, file)
+		}
+	}
+	sort.Strings(edited)
+	sort.Strings(missing)
+	return edited, missing, nil
+}
+
+// staleFiles finds the files the last sync wrote to destDir that are not
+// among the files a sync would write, given their new digests. unchanged
+// lists those still as synced, which can be deleted; edited lists those
+// changed locally since. Files already deleted are left out, and without a
+// provenance manifest nothing is reported.
+func staleFiles(destDir string, digests map[string]string) ([]string, []string, error) {
+	provenance, err := LoadProvenance(destDir)
+	if err != nil || provenance == nil {
+		return nil, nil, err
+	}
+	var unchanged, edited []string
+	for _, entry := range provenance.Files {
+		if _, ok := digests[entry.File]; ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(entry.File)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading proto file %s: %v", entry.File, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) == entry.SHA256 {
+			unchanged = append(unchanged, entry.File)
+		} else {
+			edited = append(edited, entry.File)
+		}
+	}
+	sort.Strings(unchanged)
+	sort.Strings(edited)
+	return unchanged, edited, nil
+}
+
+// syncedDir is a directory proto files are synced into
+type syncedDir struct {
+	dir string
+	// label prefixes file names in output, empty for ProtoDir
+	label string
+}
+
+// syncedDirs returns ProtoDir followed by each dependency's vendor directory
+func syncedDirs(config *Config) []syncedDir {
+	dirs := []syncedDir{{dir: config.ProtoPath()}}
+	for _, dep := range config.Deps {
+		dirs = append(dirs, syncedDir{dir: config.DepPath(dep.Name), label: filepath.ToSlash(filepath.Join(filepath.Base(config.VendorPath()), dep.Name))})
+	}
+	return dirs
+}
+
+// Which returns the provenance of a synced file. file may be relative to the
+// current directory or to ProtoDir, and may be in ProtoDir or a dependency's
+// vendor directory.
+func Which(config *Config, file string) (FileProvenance, error) {
+	type candidate struct {
+		dir, rel string
+	}
+	var candidates []candidate
+	if abs, err := filepath.Abs(file); err == nil {
+		for _, synced := range syncedDirs(config) {
+			dir, err := filepath.Abs(synced.dir)
+			if err != nil {
+				continue
+			}
+			if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				candidates = append(candidates, candidate{synced.dir, filepath.ToSlash(rel)})
+			}
+		}
+	}
+	if !filepath.IsAbs(file) {
+		candidates = append(candidates, candidate{config.ProtoPath(), path.Clean(filepath.ToSlash(file))})
+	}
+
+	for _, candidate := range candidates {
+		provenance, err := LoadProvenance(candidate.dir)
+		if err != nil {
+			return FileProvenance{}, err
+		}
+		if provenance == nil {
+			continue
+		}
+		if entry, ok := provenance.Lookup(candidate.rel); ok {
+			return entry, nil
+		}
+	}
+	return FileProvenance{}, fmt.Errorf("%s was not synced by proto; run 'proto sync' if it should have been", file)
+}
+
+// FileChange is a difference between a synced directory and its provenance
+// manifest
+type FileChange struct {
+	// File is relative to ProtoDir, or prefixed with the vendor directory of
+	// the dependency it belongs to
+	File string
+	// Status is "modified", "missing" or "untracked"
+	Status string
+}
+
+// Verify compares the files in ProtoDir and the dependency vendor
+// directories against the digests recorded when they were synced, and
+// returns every file that was modified, deleted or added since
+func Verify(config *Config) ([]FileChange, error) {
+	var changes []FileChange
+	for _, synced := range syncedDirs(config) {
+		provenance, err := LoadProvenance(synced.dir)
+		if err != nil {
+			return nil, err
+		}
+		if provenance == nil {
+			return nil, fmt.Errorf("%s has no provenance manifest; run 'proto sync' first", synced.dir)
+		}
+		dirChanges, err := verifyDir(synced, provenance)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, dirChanges...)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].File < changes[j].File
+	})
+	return changes, nil
+}
+
+// verifyDir compares one synced directory against its provenance manifest
+func verifyDir(synced syncedDir, provenance *Provenance) ([]FileChange, error) {
+	name := func(file string) string {
+		if synced.label == "" {
+			return file
+		}
+		return synced.label + "/" + file
+	}
+
+	files, err := findProtoFiles(synced.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error searching for proto files: %v", err)
+	}
+	present := map[string]bool{}
+	for _, file := range files {
+		present[file] = true
+	}
+	digests, err := digestFiles(synced.dir, files)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	tracked := map[string]bool{}
+	for _, entry := range provenance.Files {
+		tracked[entry.File] = true
+		switch {
+		case !present[entry.File]:
+			changes = append(changes, FileChange{File: name(entry.File), Status: "missing"})
+		case digests[entry.File] != entry.SHA256:
+			changes = append(changes, FileChange{File: name(entry.File), Status: "modified"})
+		}
+	}
+	for _, file := range files {
+		if !tracked[file] {
+			changes = append(changes, FileChange{File: name(file), Status: "untracked"})
+		}
+	}
+	return changes, nil
+}
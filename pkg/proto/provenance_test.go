@@ -0,0 +1,190 @@
+package proto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	bare, _ := createRepo(t, tempDir, map[string]string{
+		"protos/api/service.proto": "syntax = \"proto3\";\n",
+		"protos/api/message.proto": "syntax = \"proto3\";\n",
+	})
+	writeFiles(t, tempDir, map[string]string{"googleapis/google/api/http.proto": "syntax = \"proto3\";\n"})
+	config := &Config{
+		GitHubURL:  "file://" + bare,
+		Branch:     "main",
+		RemotePath: "protos",
+		ProtoDir:   "./proto",
+		Deps:       []Dependency{{Name: "googleapis", Source: Source{LocalPath: "googleapis"}}},
+		path:       filepath.Join(tempDir, ConfigFileName),
+	}
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	entry, err := Which(config, "proto/api/service.proto")
+	if err != nil {
+		t.Fatalf("Which() error = %v", err)
+	}
+	if entry.Source != "file://"+bare || entry.Commit != result.Revision || entry.Path != "protos/api/service.proto" || entry.SyncedAt.IsZero() {
+		t.Errorf("Which() = %+v, want the repository, commit %s and upstream path", entry, result.Revision)
+	}
+	if byProtoDir, err := Which(config, "api/service.proto"); err != nil || byProtoDir != entry {
+		t.Errorf("Which() relative to proto_dir = %+v, %v, want %+v", byProtoDir, err, entry)
+	}
+	if dep, err := Which(config, "proto_vendor/googleapis/google/api/http.proto"); err != nil || dep.Source != "googleapis" || dep.Commit != "" {
+		t.Errorf("Which() for dependency = %+v, %v, want the googleapis path", dep, err)
+	}
+	if _, err := Which(config, "proto/api/unknown.proto"); err == nil {
+		t.Error("Which() for an unsynced file error = nil, want an error")
+	}
+
+	changes, err := Verify(config)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Verify() after sync = %v, want no changes", changes)
+	}
+
+	writeFiles(t, tempDir, map[string]string{
+		"proto/api/service.proto":                    "syntax = \"proto2\";\n",
+		"proto/api/extra.proto":                      "syntax = \"proto3\";\n",
+		"proto_vendor/googleapis/google/api/x.proto": "syntax = \"proto3\";\n",
+	})
+	if err := os.Remove(filepath.Join(tempDir, "proto", "api", "message.proto")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	changes, err = Verify(config)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	want := []FileChange{
+		{File: "api/extra.proto", Status: "untracked"},
+		{File: "api/message.proto", Status: "missing"},
+		{File: "api/service.proto", Status: "modified"},
+		{File: "proto_vendor/googleapis/google/api/x.proto", Status: "untracked"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Verify() = %+v, want %+v", changes, want)
+	}
+
+	// Directories synced before manifests existed get one on the next sync,
+	// recording the upstream digests rather than the local files
+	if err := os.Remove(filepath.Join(tempDir, "proto", ProvenanceFileName)); err != nil {
+		t.Fatalf("Failed to remove manifest: %v", err)
+	}
+	if _, err := Verify(config); err == nil || !strings.Contains(err.Error(), "no provenance manifest") {
+		t.Errorf("Verify() without manifest error = %v, want a missing manifest error", err)
+	}
+	if result, err := Sync(config, SyncOptions{}); err != nil || !result.UpToDate {
+		t.Fatalf("Sync() = %+v, %v, want up to date", result, err)
+	}
+	provenance, err := LoadProvenance(filepath.Join(tempDir, "proto"))
+	if err != nil || provenance == nil || len(provenance.Files) != 2 {
+		t.Fatalf("LoadProvenance() = %+v, %v, want two files", provenance, err)
+	}
+	if recorded, _ := provenance.Lookup("api/service.proto"); recorded.SHA256 != entry.SHA256 {
+		t.Errorf("recreated manifest sha256 = %s, want upstream %s", recorded.SHA256, entry.SHA256)
+	}
+}
+
+func TestSyncLocalChanges(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"upstream/a.proto": "syntax = \"proto3\";\n",
+		"upstream/b.proto": "syntax = \"proto3\";\n",
+	})
+	config := &Config{LocalPath: "upstream", ProtoDir: "./proto", path: filepath.Join(tempDir, ConfigFileName)}
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(tempDir, filepath.FromSlash(name)))
+		return string(data)
+	}
+
+	// An unchanged source keeps and reports local edits
+	writeFiles(t, tempDir, map[string]string{"proto/a.proto": "// edited\n"})
+	os.Remove(filepath.Join(tempDir, "proto", "b.proto"))
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !result.UpToDate || !reflect.DeepEqual(result.LocalChanges, []string{"a.proto", "b.proto"}) || read("proto/a.proto") != "// edited\n" {
+		t.Errorf("Sync() = %+v, want up to date with a.proto and b.proto changed locally", result)
+	}
+	if _, _, err := ExportBundle(config, filepath.Join(tempDir, "protos.tar.gz")); err == nil {
+		t.Error("ExportBundle() with local edits error = nil, want an error")
+	}
+
+	// --force restores them
+	result, err = Sync(config, SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Sync() with force error = %v", err)
+	}
+	if result.UpToDate || len(result.LocalChanges) != 0 || read("proto/a.proto") != "syntax = \"proto3\";\n" || read("proto/b.proto") == "" {
+		t.Errorf("Sync() with force = %+v, want the files restored", result)
+	}
+
+	// Upstream changes to untouched files are applied as usual
+	writeFiles(t, tempDir, map[string]string{"upstream/b.proto": "syntax = \"proto3\";\npackage b;\n"})
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	// A sync that would overwrite local edits is refused; a dry run reports
+	// the edits instead
+	writeFiles(t, tempDir, map[string]string{
+		"proto/a.proto":    "// edited\n",
+		"proto/c.proto":    "// added locally\n",
+		"upstream/b.proto": "syntax = \"proto3\";\npackage b.v2;\n",
+		"upstream/c.proto": "syntax = \"proto3\";\n",
+	})
+	var changesErr *LocalChangesError
+	if _, err := Sync(config, SyncOptions{}); !errors.As(err, &changesErr) || !reflect.DeepEqual(changesErr.Files, []string{"a.proto", "c.proto"}) {
+		t.Errorf("Sync() error = %v, want a.proto and c.proto modified locally", err)
+	}
+	result, err = Sync(config, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync() dry run error = %v", err)
+	}
+	if result.UpToDate || !reflect.DeepEqual(result.LocalChanges, []string{"a.proto", "c.proto"}) {
+		t.Errorf("Sync() dry run = %+v, want a.proto and c.proto reported as changed locally", result)
+	}
+	if read("proto/a.proto") != "// edited\n" || read("proto/b.proto") != "syntax = \"proto3\";\npackage b;\n" {
+		t.Error("a refused sync changed the proto directory")
+	}
+	if _, err := Sync(config, SyncOptions{Force: true}); err != nil {
+		t.Fatalf("Sync() with force error = %v", err)
+	}
+	if read("proto/a.proto") != "syntax = \"proto3\";\n" || read("proto/c.proto") != "syntax = \"proto3\";\n" {
+		t.Error("Sync() with force did not overwrite the local edits")
+	}
+	if changes, err := Verify(config); err != nil || len(changes) != 0 {
+		t.Errorf("Verify() after forced sync = %v, %v, want no changes", changes, err)
+	}
+}
@@ -0,0 +1,334 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Python configures managed Python output. Without a package, gen writes the
+// generated modules straight into BuildDir with protoc's top-level imports.
+type Python struct {
+	// Package is the dotted root package the generated modules are placed
+	// under, e.g. "ourapi" to import them as ourapi.foo.v1
+	Package string `yaml:"package,omitempty"`
+	// Pyproject writes a pyproject.toml to BuildDir so it can be installed
+	// with pip
+	Pyproject bool `yaml:"pyproject,omitempty"`
+	// Version is the project version written to pyproject.toml, 0.0.0 if
+	// unset
+	Version string `yaml:"version,omitempty"`
+}
+
+// pythonPackagePattern matches a dotted Python package name
+var pythonPackagePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// validate reports Python settings that cannot take effect
+func (p Python) validate() []string {
+	var problems []string
+	if p.Package != "" && !pythonPackagePattern.MatchString(p.Package) {
+		problems = append(problems, fmt.Sprintf("python.package must be a dotted Python package name, not %q", p.Package))
+	}
+	if p.Pyproject && p.Package == "" {
+		problems = append(problems, "python.pyproject requires python.package")
+	}
+	if p.Version != "" && !p.Pyproject {
+		problems = append(problems, "python.version has no effect without python.pyproject: true")
+	}
+	return problems
+}
+
+// PythonOutPath returns the directory Python code is generated into: the
+// root package directory under BuildDir in managed mode, BuildDir otherwise
+func (c *Config) PythonOutPath() string {
+	if c.Python.Package == "" {
+		return c.BuildPath()
+	}
+	return filepath.Join(c.BuildPath(), filepath.FromSlash(strings.ReplaceAll(c.Python.Package, ".", "/")))
+}
+
+// ScaffoldPython turns the Python code generated under PythonOutPath into an
+// importable package: every directory gets an __init__.py, imports between
+// generated modules are rewritten to be relative to the package, and a
+// pyproject.toml is written if configured. It does nothing unless
+// python.package is set, and is safe to run again after regenerating some
+// of the files.
+func ScaffoldPython(config *Config) error {
+	if config.Python.Package == "" {
+		return nil
+	}
+	root := config.PythonOutPath()
+
+	// Collect the generated packages and modules, as dotted names relative
+	// to the root package
+	packages := map[string]bool{"": true}
+	modules := map[string]bool{}
+	var sources []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		dotted := strings.ReplaceAll(filepath.ToSlash(rel), "/", ".")
+		if info.IsDir() {
+			if rel != "." {
+				packages[dotted] = true
+			}
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".py", ".pyi":
+			if module := strings.TrimSuffix(dotted, filepath.Ext(path)); filepath.Base(path) != "__init__.py" {
+				modules[module] = true
+				sources = append(sources, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", root, err)
+	}
+
+	for _, path := range sources {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, filepath.Dir(path))
+		pkg := ""
+		if rel != "." {
+			pkg = strings.ReplaceAll(filepath.ToSlash(rel), "/", ".")
+		}
+		rewritten := rewritePythonImports(string(data), pkg, packages, modules)
+		if rewritten != string(data) {
+			if err := os.WriteFile(path, []byte(rewritten), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Every package directory, including the ones leading from BuildDir to
+	// a dotted root package, needs an __init__.py
+	dirs := []string{root}
+	for pkg := range packages {
+		if pkg != "" {
+			dirs = append(dirs, filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(pkg, ".", "/"))))
+		}
+	}
+	buildDir := filepath.Clean(config.BuildPath())
+	for dir := filepath.Dir(root); dir != buildDir && dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		if err := writeIfMissing(filepath.Join(dir, "__init__.py"), nil); err != nil {
+			return err
+		}
+	}
+	// The .pyi stubs mypy-protobuf generates are only used by type checkers
+	// once the package is marked as typed
+	if err := writeIfMissing(filepath.Join(root, "py.typed"), nil); err != nil {
+		return err
+	}
+
+	if config.Python.Pyproject {
+		if err := os.WriteFile(filepath.Join(config.BuildPath(), "pyproject.toml"), []byte(pyproject(config.Python)), 0644); err != nil {
+			return fmt.Errorf("error writing pyproject.toml: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeIfMissing creates path with data unless it already exists
+func writeIfMissing(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+var (
+	// pythonFromImport matches an absolute "from x.y import z" statement
+	pythonFromImport = regexp.MustCompile(`^(\s*)from (\w[\w.]*) import (.+)$`)
+	// pythonImport matches "import x.y.z" with an optional alias
+	pythonImport = regexp.MustCompile(`^(\s*)import (\w[\w.]*)(?: as (\w+))?\s*$`)
+)
+
+// rewritePythonImports rewrites the imports of other generated modules in a
+// module of package pkg to be relative, leaving imports of anything else,
+// such as google.protobuf, alone. Since a relative import can only bind the
+// last component of a dotted name, modules imported as "import a.b_pb2"
+// are bound to an alias instead and the references to them renamed.
+func rewritePythonImports(content, pkg string, packages, modules map[string]bool) string {
+	renames := map[string]string{}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if m := pythonFromImport.FindStringSubmatch(line); m != nil {
+			if packages[m[2]] {
+				lines[i] = m[1] + "from " + relativeModule(pkg, m[2]) + " import " + m[3]
+			}
+			continue
+		}
+		m := pythonImport.FindStringSubmatch(line)
+		if m == nil || !modules[m[2]] {
+			continue
+		}
+		parent, name := "", m[2]
+		if dot := strings.LastIndex(m[2], "."); dot >= 0 {
+			parent, name = m[2][:dot], m[2][dot+1:]
+		}
+		alias := m[3]
+		if alias == "" && parent != "" {
+			alias = mangleModule(m[2])
+			renames[m[2]] = alias
+		}
+		lines[i] = m[1] + "from " + relativeModule(pkg, parent) + " import " + name
+		if alias != "" && alias != name {
+			lines[i] += " as " + alias
+		}
+	}
+	content = strings.Join(lines, "\n")
+
+	for module, alias := range renames {
+		reference := regexp.MustCompile(`(^|[^\w.])` + regexp.QuoteMeta(module) + `\b`)
+		content = reference.ReplaceAllString(content, "${1}"+alias)
+	}
+	return content
+}
+
+// relativeModule returns the relative import of target from a module in
+// package from, both dotted names relative to the root package
+func relativeModule(from, target string) string {
+	var fromParts, targetParts []string
+	if from != "" {
+		fromParts = strings.Split(from, ".")
+	}
+	if target != "" {
+		targetParts = strings.Split(target, ".")
+	}
+	common := 0
+	for common < len(fromParts) && common < len(targetParts) && fromParts[common] == targetParts[common] {
+		common++
+	}
+	return strings.Repeat(".", len(fromParts)-common+1) + strings.Join(targetParts[common:], ".")
+}
+
+// mangleModule names the alias of a module the way protoc does, e.g.
+// foo_dot_v1_dot_bar__pb2 for foo.v1.bar_pb2
+func mangleModule(module string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(module, "_", "__"), ".", "_dot_")
+}
+
+// pyproject renders the pyproject.toml for the generated package
+func pyproject(p Python) string {
+	version := p.Version
+	if version == "" {
+		version = "0.0.0"
+	}
+	name := strings.NewReplacer(".", "-", "_", "-").Replace(p.Package)
+	top, _, _ := strings.Cut(p.Package, ".")
+	return fmt.Sprintf(`# Generated by proto gen, changes will be overwritten
+[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = %q
+version = %q
+dependencies = ["protobuf", "grpcio"]
+
+[tool.setuptools.packages.find]
+include = [%q, %q]
+
+[tool.setuptools.package-data]
+"*" = ["*.pyi", "py.typed"]
+`, name, version, top, top+".*")
+}
+
+// Ways gen can run protoc for Python
+const (
+	// PythonModeProtoc runs the system protoc with the gRPC plugin
+	PythonModeProtoc = "protoc"
+	// PythonModeGrpcTools runs the protoc bundled with grpcio-tools, as
+	// python3 -m grpc_tools.protoc
+	PythonModeGrpcTools = "grpc_tools"
+)
+
+// PythonGenMode describes how gen runs protoc for Python
+type PythonGenMode struct {
+	Mode string
+	// Plugin is the gRPC plugin to pass to protoc with --plugin, when it is
+	// installed as grpc_python_plugin, which protoc does not find by itself
+	Plugin string
+	// Reason explains why the mode was chosen
+	Reason string
+}
+
+// SelectPythonGenMode picks how to generate Python gRPC code. protoc only
+// finds the gRPC plugin as protoc-gen-grpc_python on PATH, which neither pip
+// nor most package managers install, so unless it or a grpc_python_plugin
+// built from the gRPC sources is found, gen falls back to the protoc bundled
+// with grpcio-tools. lookPath locates each tool and hasModule reports whether
+// python3 can import a module.
+func SelectPythonGenMode(lookPath func(string) (string, error), hasModule func(string) bool) (PythonGenMode, error) {
+	_, protocErr := lookPath("protoc")
+	if protocErr == nil {
+		if path, err := lookPath("protoc-gen-grpc_python"); err == nil {
+			return PythonGenMode{Mode: PythonModeProtoc, Reason: "protoc-gen-grpc_python found at " + path}, nil
+		}
+		if path, err := lookPath("grpc_python_plugin"); err == nil {
+			return PythonGenMode{Mode: PythonModeProtoc, Plugin: path, Reason: "grpc_python_plugin found at " + path}, nil
+		}
+	}
+
+	missing := "protoc-gen-grpc_python not found"
+	if protocErr != nil {
+		missing = "protoc not found"
+	}
+	if hasModule("grpc_tools") {
+		return PythonGenMode{Mode: PythonModeGrpcTools, Reason: missing + ", falling back to the protoc bundled with grpcio-tools"}, nil
+	}
+	return PythonGenMode{}, fmt.Errorf("%s and grpcio-tools is not installed", missing)
+}
+
+// grpcToolsProtoc is the path recorded for the protoc bundled with
+// grpcio-tools
+const grpcToolsProtoc = "python3 -m grpc_tools.protoc"
+
+// CheckPythonToolchain checks the tools gen runs for Python in mode against
+// the pinned toolchain, like CheckToolchain. In grpc_tools mode protoc is the
+// copy bundled with grpcio-tools, which has the gRPC plugin built in, so that
+// copy is held to the protoc pin and no gRPC plugin is checked. A
+// grpc_python_plugin used in place of protoc-gen-grpc_python is held to the
+// latter's pin.
+func CheckPythonToolchain(toolchain Toolchain, mode PythonGenMode, lookPath func(string) (string, error)) []ToolStatus {
+	if mode.Mode == PythonModeGrpcTools {
+		return checkTools(toolchain, []string{"protoc", "protoc-gen-mypy"}, func(tool string) (string, error) {
+			if tool == "protoc" {
+				return grpcToolsProtoc, nil
+			}
+			return lookPath(tool)
+		}, func(path string) (string, error) {
+			if path == grpcToolsProtoc {
+				return commandVersion("python3", "-m", "grpc_tools.protoc")
+			}
+			return ToolVersion(path)
+		})
+	}
+	if mode.Plugin != "" {
+		find := lookPath
+		lookPath = func(tool string) (string, error) {
+			if tool == "protoc-gen-grpc_python" {
+				return mode.Plugin, nil
+			}
+			return find(tool)
+		}
+	}
+	return CheckToolchain(toolchain, TargetTools["python"], lookPath)
+}
@@ -0,0 +1,219 @@
+package proto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRewritePythonImports(t *testing.T) {
+	packages := map[string]bool{"": true, "foo": true, "foo.v1": true, "bar": true}
+	modules := map[string]bool{
+		"common_pb2":         true,
+		"foo.v1.service_pb2": true,
+		"foo.v1.user_pb2":    true,
+		"bar.types_pb2":      true,
+		"bar.types_pb2_grpc": true,
+	}
+	tests := []struct {
+		name string
+		pkg  string
+		in   string
+		want string
+	}{
+		{
+			name: "same package",
+			pkg:  "foo.v1",
+			in:   "from foo.v1 import user_pb2 as foo_dot_v1_dot_user__pb2\n",
+			want: "from . import user_pb2 as foo_dot_v1_dot_user__pb2\n",
+		},
+		{
+			name: "sibling package",
+			pkg:  "foo.v1",
+			in:   "from bar import types_pb2 as bar_dot_types__pb2\n",
+			want: "from ...bar import types_pb2 as bar_dot_types__pb2\n",
+		},
+		{
+			name: "root module with alias",
+			pkg:  "foo.v1",
+			in:   "import common_pb2 as common__pb2\n",
+			want: "from ... import common_pb2 as common__pb2\n",
+		},
+		{
+			name: "root module from the root",
+			pkg:  "",
+			in:   "import common_pb2\n",
+			want: "from . import common_pb2\n",
+		},
+		{
+			name: "stub references",
+			pkg:  "bar",
+			in:   "import builtins\nimport foo.v1.user_pb2\n\nclass Types:\n    def user(self) -> foo.v1.user_pb2.User: ...\n    other: foo.v1.user_pb2_extra\n",
+			want: "import builtins\nfrom ..foo.v1 import user_pb2 as foo_dot_v1_dot_user__pb2\n\nclass Types:\n    def user(self) -> foo_dot_v1_dot_user__pb2.User: ...\n    other: foo.v1.user_pb2_extra\n",
+		},
+		{
+			name: "well-known types",
+			pkg:  "foo.v1",
+			in:   "from google.protobuf import timestamp_pb2 as google_dot_protobuf_dot_timestamp__pb2\nimport google.protobuf.message\n",
+			want: "from google.protobuf import timestamp_pb2 as google_dot_protobuf_dot_timestamp__pb2\nimport google.protobuf.message\n",
+		},
+		{
+			name: "already relative",
+			pkg:  "foo.v1",
+			in:   "from . import user_pb2 as foo_dot_v1_dot_user__pb2\n",
+			want: "from . import user_pb2 as foo_dot_v1_dot_user__pb2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewritePythonImports(tt.in, tt.pkg, packages, modules); got != tt.want {
+				t.Errorf("rewritePythonImports() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaffoldPython(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &Config{
+		BuildDir: filepath.Join(tempDir, "gen"),
+		Python:   Python{Package: "ourco.api", Pyproject: true, Version: "1.2.0"},
+	}
+	root := config.PythonOutPath()
+	if want := filepath.Join(tempDir, "gen", "ourco", "api"); root != want {
+		t.Fatalf("PythonOutPath() = %s, want %s", root, want)
+	}
+	writeFiles(t, root, map[string]string{
+		"foo/v1/service_pb2.py":      "from foo.v1 import user_pb2 as foo_dot_v1_dot_user__pb2\n",
+		"foo/v1/service_pb2_grpc.py": "import grpc\nfrom foo.v1 import service_pb2 as foo_dot_v1_dot_service__pb2\n",
+		"foo/v1/user_pb2.py":         "from google.protobuf import descriptor as _descriptor\n",
+	})
+	writeFiles(t, config.BuildPath(), map[string]string{"foo/v1/service.pb.go": "package foo\n"})
+
+	if err := ScaffoldPython(config); err != nil {
+		t.Fatalf("ScaffoldPython() error = %v", err)
+	}
+	// Running again, as after regenerating some files, changes nothing
+	if err := ScaffoldPython(config); err != nil {
+		t.Fatalf("ScaffoldPython() second run error = %v", err)
+	}
+
+	for _, file := range []string{
+		"ourco/__init__.py",
+		"ourco/api/__init__.py",
+		"ourco/api/py.typed",
+		"ourco/api/foo/__init__.py",
+		"ourco/api/foo/v1/__init__.py",
+	} {
+		if _, err := os.Stat(filepath.Join(config.BuildPath(), file)); err != nil {
+			t.Errorf("ScaffoldPython() did not create %s: %v", file, err)
+		}
+	}
+	// Only the Python package is scaffolded, not the rest of BuildDir
+	for _, file := range []string{"__init__.py", "foo/__init__.py"} {
+		if _, err := os.Stat(filepath.Join(config.BuildPath(), file)); !os.IsNotExist(err) {
+			t.Errorf("ScaffoldPython() created %s outside the package", file)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "foo", "v1", "service_pb2_grpc.py"))
+	if err != nil {
+		t.Fatalf("Failed to read module: %v", err)
+	}
+	if want := "import grpc\nfrom . import service_pb2 as foo_dot_v1_dot_service__pb2\n"; string(data) != want {
+		t.Errorf("Rewritten module = %q, want %q", data, want)
+	}
+
+	data, err = os.ReadFile(filepath.Join(config.BuildPath(), "pyproject.toml"))
+	if err != nil {
+		t.Fatalf("Failed to read pyproject.toml: %v", err)
+	}
+	for _, want := range []string{`name = "ourco-api"`, `version = "1.2.0"`, `include = ["ourco", "ourco.*"]`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("pyproject.toml does not contain %s:\n%s", want, data)
+		}
+	}
+
+	// Without a package nothing is scaffolded
+	config.Python = Python{}
+	if got := config.PythonOutPath(); got != config.BuildPath() {
+		t.Errorf("PythonOutPath() without a package = %s, want %s", got, config.BuildPath())
+	}
+	if err := ScaffoldPython(config); err != nil {
+		t.Errorf("ScaffoldPython() without a package error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.BuildPath(), "__init__.py")); !os.IsNotExist(err) {
+		t.Error("ScaffoldPython() without a package created __init__.py")
+	}
+}
+
+func TestSelectPythonGenMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		tools     []string
+		grpcTools bool
+		want      PythonGenMode
+		wantErr   string
+	}{
+		{
+			name:  "plugin installed",
+			tools: []string{"protoc", "protoc-gen-grpc_python", "grpc_python_plugin"},
+			want:  PythonGenMode{Mode: PythonModeProtoc, Reason: "protoc-gen-grpc_python found at /bin/protoc-gen-grpc_python"},
+		},
+		{
+			name:      "plugin built from source",
+			tools:     []string{"protoc", "grpc_python_plugin"},
+			grpcTools: true,
+			want:      PythonGenMode{Mode: PythonModeProtoc, Plugin: "/bin/grpc_python_plugin", Reason: "grpc_python_plugin found at /bin/grpc_python_plugin"},
+		},
+		{
+			name:      "plugin missing",
+			tools:     []string{"protoc"},
+			grpcTools: true,
+			want:      PythonGenMode{Mode: PythonModeGrpcTools, Reason: "protoc-gen-grpc_python not found, falling back to the protoc bundled with grpcio-tools"},
+		},
+		{
+			name:      "protoc missing",
+			tools:     []string{"protoc-gen-grpc_python"},
+			grpcTools: true,
+			want:      PythonGenMode{Mode: PythonModeGrpcTools, Reason: "protoc not found, falling back to the protoc bundled with grpcio-tools"},
+		},
+		{
+			name:    "nothing installed",
+			tools:   []string{"protoc"},
+			wantErr: "protoc-gen-grpc_python not found and grpcio-tools is not installed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookPath := func(tool string) (string, error) {
+				for _, installed := range tt.tools {
+					if installed == tool {
+						return "/bin/" + tool, nil
+					}
+				}
+				return "", errors.New("not found")
+			}
+			hasModule := func(module string) bool {
+				return module == "grpc_tools" && tt.grpcTools
+			}
+			got, err := SelectPythonGenMode(lookPath, hasModule)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("SelectPythonGenMode() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("SelectPythonGenMode() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
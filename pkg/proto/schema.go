@@ -0,0 +1,357 @@
+package proto
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// protoSchema holds the declarations of a set of .proto files that matter to
+// generated code, keyed by fully qualified name
+type protoSchema struct {
+	// messages maps each message to its fields by name
+	messages map[string]map[string]protoField
+	// enums maps each enum to its values' numbers by name
+	enums map[string]map[string]string
+	// rpcs maps each Service.Method to its signature
+	rpcs map[string]string
+}
+
+// protoField is a message field
+type protoField struct {
+	Label  string
+	Type   string
+	Number string
+}
+
+func (f protoField) String() string {
+	return strings.TrimSpace(f.Label+" "+f.Type) + " = " + f.Number
+}
+
+func newProtoSchema() *protoSchema {
+	return &protoSchema{
+		messages: map[string]map[string]protoField{},
+		enums:    map[string]map[string]string{},
+		rpcs:     map[string]string{},
+	}
+}
+
+// tokenPattern splits proto source, with comments removed, into tokens
+var tokenPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[A-Za-z_.][A-Za-z0-9_.]*|-?[0-9][A-Za-z0-9_.+-]*|\S`)
+
+// addFile parses a .proto file into the schema. The parser only understands
+// the declarations it records and skips anything else, so unusual syntax
+// makes the summary less complete rather than failing.
+func (s *protoSchema) addFile(data []byte) {
+	p := &schemaParser{tokens: tokenPattern.FindAllString(stripComments(string(data)), -1), schema: s}
+	if pkg := ParsePackage(data); pkg != "" {
+		p.parseBody(pkg+".", "")
+		return
+	}
+	p.parseBody("", "")
+}
+
+type schemaParser struct {
+	tokens []string
+	pos    int
+	schema *protoSchema
+}
+
+func (p *schemaParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *schemaParser) next() string {
+	token := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return token
+}
+
+// skipStatement skips to the end of the current statement, including a
+// block if the statement has one
+func (p *schemaParser) skipStatement() {
+	for p.pos < len(p.tokens) {
+		switch p.next() {
+		case ";":
+			return
+		case "{":
+			p.skipBlock()
+			return
+		}
+	}
+}
+
+// skipBlock skips past the "}" closing a block whose "{" was just read
+func (p *schemaParser) skipBlock() {
+	for depth := 1; depth > 0 && p.pos < len(p.tokens); {
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+}
+
+// parseBody parses declarations until the closing "}" of the current block
+// or the end of the file. prefix qualifies the names declared, and message
+// is the enclosing message whose fields are being read, if any.
+func (p *schemaParser) parseBody(prefix, message string) {
+	for p.pos < len(p.tokens) {
+		switch token := p.peek(); token {
+		case "}":
+			p.next()
+			return
+		case ";":
+			p.next()
+		case "message":
+			p.next()
+			name := prefix + p.next()
+			if p.next() != "{" {
+				p.skipStatement()
+				continue
+			}
+			if _, ok := p.schema.messages[name]; !ok {
+				p.schema.messages[name] = map[string]protoField{}
+			}
+			p.parseBody(name+".", name)
+		case "enum":
+			p.next()
+			name := prefix + p.next()
+			if p.next() != "{" {
+				p.skipStatement()
+				continue
+			}
+			p.parseEnum(name)
+		case "service":
+			p.next()
+			name := prefix + p.next()
+			if p.next() != "{" {
+				p.skipStatement()
+				continue
+			}
+			p.parseService(name)
+		case "oneof":
+			// Fields in a oneof belong to the enclosing message
+			p.next()
+			p.next()
+			if p.next() != "{" {
+				p.skipStatement()
+				continue
+			}
+			p.parseBody(prefix, message)
+		case "syntax", "edition", "package", "import", "option", "reserved", "extensions", "extend":
+			p.skipStatement()
+		default:
+			if message == "" || !p.parseField(message) {
+				p.skipStatement()
+			}
+		}
+	}
+}
+
+// parseField parses a field declaration of message, reporting whether the
+// tokens looked like one
+func (p *schemaParser) parseField(message string) bool {
+	start := p.pos
+	field := protoField{}
+	switch p.peek() {
+	case "repeated", "optional", "required":
+		field.Label = p.next()
+	}
+	if p.peek() == "map" {
+		p.next()
+		var parts []string
+		for p.pos < len(p.tokens) && p.peek() != ">" {
+			parts = append(parts, p.next())
+		}
+		p.next()
+		field.Type = "map" + strings.Join(parts, "") + ">"
+		field.Type = strings.Replace(field.Type, ",", ", ", 1)
+	} else {
+		field.Type = p.next()
+	}
+	name := p.next()
+	if p.next() != "=" {
+		p.pos = start
+		return false
+	}
+	field.Number = p.next()
+	p.skipStatement()
+	p.schema.messages[message][name] = field
+	return true
+}
+
+// parseEnum parses the values of an enum until its closing "}"
+func (p *schemaParser) parseEnum(name string) {
+	values := map[string]string{}
+	p.schema.enums[name] = values
+	for p.pos < len(p.tokens) {
+		switch token := p.next(); token {
+		case "}":
+			return
+		case ";":
+		case "option", "reserved":
+			p.skipStatement()
+		default:
+			if p.peek() != "=" {
+				p.skipStatement()
+				continue
+			}
+			p.next()
+			values[token] = p.next()
+			p.skipStatement()
+		}
+	}
+}
+
+// parseService parses the methods of a service until its closing "}"
+func (p *schemaParser) parseService(name string) {
+	for p.pos < len(p.tokens) {
+		switch p.next() {
+		case "}":
+			return
+		case "rpc":
+			method := p.next()
+			var signature []string
+			for p.pos < len(p.tokens) && p.peek() != ";" && p.peek() != "{" {
+				signature = append(signature, p.next())
+			}
+			p.rpc(name+"."+method, signature)
+			p.skipStatement()
+		case ";":
+		default:
+			p.skipStatement()
+		}
+	}
+}
+
+// rpc records a method's signature, normalizing its spacing
+func (p *schemaParser) rpc(name string, tokens []string) {
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 && token != ")" && tokens[i-1] != "(" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(token)
+	}
+	p.schema.rpcs[name] = b.String()
+}
+
+// SchemaChange is a change to a message, field, enum or RPC
+type SchemaChange struct {
+	// Change is "added", "removed" or "changed"
+	Change string
+	// Kind is "message", "field", "enum", "enum value" or "rpc"
+	Kind string
+	// Name is the fully qualified name
+	Name string
+	// Detail describes the declaration, or for changes what changed
+	Detail string
+}
+
+func (c SchemaChange) String() string {
+	s := fmt.Sprintf("%s %s %s", strings.ToUpper(c.Change[:1])+c.Change[1:], c.Kind, c.Name)
+	if c.Detail == "" {
+		return s
+	}
+	if c.Change == "changed" {
+		return s + ": " + c.Detail
+	}
+	return s + " (" + c.Detail + ")"
+}
+
+// diffSchemas lists the changes from old to new, sorted by name. The members
+// of added or removed messages and enums are not listed separately.
+func diffSchemas(old, new *protoSchema) []SchemaChange {
+	var changes []SchemaChange
+	for _, name := range unionKeys(old.messages, new.messages) {
+		before, inOld := old.messages[name]
+		after, inNew := new.messages[name]
+		switch {
+		case !inOld:
+			changes = append(changes, SchemaChange{Change: "added", Kind: "message", Name: name})
+		case !inNew:
+			changes = append(changes, SchemaChange{Change: "removed", Kind: "message", Name: name})
+		default:
+			for _, field := range unionKeys(before, after) {
+				b, inBefore := before[field]
+				a, inAfter := after[field]
+				full := name + "." + field
+				switch {
+				case !inBefore:
+					changes = append(changes, SchemaChange{Change: "added", Kind: "field", Name: full, Detail: a.String()})
+				case !inAfter:
+					changes = append(changes, SchemaChange{Change: "removed", Kind: "field", Name: full, Detail: b.String()})
+				case a != b:
+					changes = append(changes, SchemaChange{Change: "changed", Kind: "field", Name: full, Detail: b.String() + " -> " + a.String()})
+				}
+			}
+		}
+	}
+
+	for _, name := range unionKeys(old.enums, new.enums) {
+		before, inOld := old.enums[name]
+		after, inNew := new.enums[name]
+		switch {
+		case !inOld:
+			changes = append(changes, SchemaChange{Change: "added", Kind: "enum", Name: name})
+		case !inNew:
+			changes = append(changes, SchemaChange{Change: "removed", Kind: "enum", Name: name})
+		default:
+			for _, value := range unionKeys(before, after) {
+				b, inBefore := before[value]
+				a, inAfter := after[value]
+				full := name + "." + value
+				switch {
+				case !inBefore:
+					changes = append(changes, SchemaChange{Change: "added", Kind: "enum value", Name: full, Detail: "= " + a})
+				case !inAfter:
+					changes = append(changes, SchemaChange{Change: "removed", Kind: "enum value", Name: full, Detail: "= " + b})
+				case a != b:
+					changes = append(changes, SchemaChange{Change: "changed", Kind: "enum value", Name: full, Detail: b + " -> " + a})
+				}
+			}
+		}
+	}
+
+	for _, name := range unionKeys(old.rpcs, new.rpcs) {
+		before, inOld := old.rpcs[name]
+		after, inNew := new.rpcs[name]
+		switch {
+		case !inOld:
+			changes = append(changes, SchemaChange{Change: "added", Kind: "rpc", Name: name, Detail: after})
+		case !inNew:
+			changes = append(changes, SchemaChange{Change: "removed", Kind: "rpc", Name: name, Detail: before})
+		case before != after:
+			changes = append(changes, SchemaChange{Change: "changed", Kind: "rpc", Name: name, Detail: before + " -> " + after})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// unionKeys returns the keys of a and b, sorted
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	old := newProtoSchema()
+	old.addFile([]byte(`syntax = "proto3";
+package example.v1;
+
+import "google/protobuf/empty.proto";
+
+option go_package = "example.com/v1;v1";
+
+// A user
+message User {
+  string id = 1;
+  string name = 2 [deprecated = true];
+  int32 age = 3;
+  message Address { string city = 1; }
+  oneof contact {
+    string email = 4;
+    string phone = 5;
+  }
+  reserved 9;
+}
+
+message Legacy {}
+
+enum Status {
+  option allow_alias = true;
+  STATUS_UNSPECIFIED = 0;
+  STATUS_ACTIVE = 1;
+  STATUS_GONE = 2;
+}
+
+service Users {
+  rpc GetUser(GetUserRequest) returns (User);
+  rpc DeleteUser(User) returns (google.protobuf.Empty) {
+    option deprecated = true;
+  }
+}
+`))
+	new := newProtoSchema()
+	new.addFile([]byte(`syntax = "proto3";
+package example.v1;
+
+message User {
+  string id = 1;
+  string name = 2;
+  int64 age = 3;
+  message Address { string city = 1; string zip = 2; }
+  oneof contact {
+    string email = 4;
+  }
+  repeated string tags = 6;
+  map<string, string> labels = 7;
+}
+
+message Group {}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_ACTIVE = 3;
+  STATUS_SUSPENDED = 4;
+}
+
+service Users {
+  rpc GetUser(GetUserRequest) returns (stream User);
+  rpc ListUsers(ListUsersRequest) returns (ListUsersResponse);
+}
+`))
+
+	want := []string{
+		"Added message example.v1.Group",
+		"Removed message example.v1.Legacy",
+		"Changed enum value example.v1.Status.STATUS_ACTIVE: 1 -> 3",
+		"Removed enum value example.v1.Status.STATUS_GONE (= 2)",
+		"Added enum value example.v1.Status.STATUS_SUSPENDED (= 4)",
+		"Added field example.v1.User.Address.zip (string = 2)",
+		"Changed field example.v1.User.age: int32 = 3 -> int64 = 3",
+		"Added field example.v1.User.labels (map<string, string> = 7)",
+		"Removed field example.v1.User.phone (string = 5)",
+		"Added field example.v1.User.tags (repeated string = 6)",
+		"Removed rpc example.v1.Users.DeleteUser ((User) returns (google.protobuf.Empty))",
+		"Changed rpc example.v1.Users.GetUser: (GetUserRequest) returns (User) -> (GetUserRequest) returns (stream User)",
+		"Added rpc example.v1.Users.ListUsers ((ListUsersRequest) returns (ListUsersResponse))",
+	}
+	var got []string
+	for _, change := range diffSchemas(old, new) {
+		got = append(got, change.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSchemas() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,230 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Setting is a scalar config key that can be overridden from the environment
+// or a command-line flag
+type Setting struct {
+	// Key is the dotted YAML path of the setting, e.g. "toolchain.protoc"
+	Key string
+	// Env is the environment variable that overrides the setting
+	Env string
+
+	get func(*Config) string
+	set func(*Config, string) error
+}
+
+// Get returns the current value of the setting
+func (s Setting) Get(c *Config) string {
+	return s.get(c)
+}
+
+// Set updates the setting on c
+func (s Setting) Set(c *Config, value string) error {
+	return s.set(c, value)
+}
+
+// Settings lists every overridable config key in .protorc order
+var Settings = []Setting{
+	stringSetting("github_url", func(c *Config) *string { return &c.GitHubURL }),
+	// PROTO_PATH commonly lists protobuf include paths, so the local source
+	// gets a more specific variable
+	withEnv(stringSetting("path", func(c *Config) *string { return &c.LocalPath }), "PROTO_SOURCE_PATH"),
+	stringSetting("archive.url", func(c *Config) *string { return &c.Archive.URL }),
+	stringSetting("archive.sha256", func(c *Config) *string { return &c.Archive.SHA256 }),
+	stringSetting("archive.strip_prefix", func(c *Config) *string { return &c.Archive.StripPrefix }),
+	stringSetting("archive.subpath", func(c *Config) *string { return &c.Archive.Subpath }),
+	stringSetting("branch", func(c *Config) *string { return &c.Branch }),
+	stringSetting("remote_path", func(c *Config) *string { return &c.RemotePath }),
+	listSetting("include", func(c *Config) *[]string { return &c.Include }),
+	listSetting("exclude", func(c *Config) *[]string { return &c.Exclude }),
+	listSetting("roots", func(c *Config) *[]string { return &c.Roots }),
+	boolSetting("verify_signatures", func(c *Config) *bool { return &c.VerifySignatures }),
+	stringSetting("allowed_signers", func(c *Config) *string { return &c.AllowedSigners }),
+	stringSetting("proto_dir", func(c *Config) *string { return &c.ProtoDir }),
+	stringSetting("build_dir", func(c *Config) *string { return &c.BuildDir }),
+	stringSetting("vendor_dir", func(c *Config) *string { return &c.VendorDir }),
+	stringSetting("changelog", func(c *Config) *string { return &c.Changelog }),
+	stringSetting("auth.ssh_key", func(c *Config) *string { return &c.Auth.SSHKey }),
+	stringSetting("auth.token_env", func(c *Config) *string { return &c.Auth.TokenEnv }),
+	stringSetting("auth.token_user", func(c *Config) *string { return &c.Auth.TokenUser }),
+	stringSetting("auth.token_method", func(c *Config) *string { return &c.Auth.TokenMethod }),
+	stringSetting("auth.netrc", func(c *Config) *string { return &c.Auth.Netrc }),
+	stringSetting("toolchain.protoc", func(c *Config) *string { return &c.Toolchain.Protoc }),
+	{
+		Key: "toolchain.plugins",
+		Env: "PROTO_TOOLCHAIN_PLUGINS",
+		get: func(c *Config) string { return formatPlugins(c.Toolchain.Plugins) },
+		set: func(c *Config, value string) error {
+			plugins, err := parsePlugins(value)
+			if err != nil {
+				return err
+			}
+			c.Toolchain.Plugins = plugins
+			return nil
+		},
+	},
+	stringSetting("toolchain.mirror", func(c *Config) *string { return &c.Toolchain.Mirror }),
+	stringSetting("python.package", func(c *Config) *string { return &c.Python.Package }),
+	boolSetting("python.pyproject", func(c *Config) *bool { return &c.Python.Pyproject }),
+	stringSetting("python.version", func(c *Config) *string { return &c.Python.Version }),
+}
+
+// stringSetting builds a Setting for a plain string field, deriving the
+// environment variable from the key
+func stringSetting(key string, field func(*Config) *string) Setting {
+	return Setting{
+		Key: key,
+		Env: "PROTO_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_")),
+		get: func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// withEnv overrides the environment variable derived from a setting's key
+func withEnv(setting Setting, env string) Setting {
+	setting.Env = env
+	return setting
+}
+
+// boolSetting builds a Setting for a boolean field, which overrides give as
+// true or false
+func boolSetting(key string, field func(*Config) *bool) Setting {
+	return Setting{
+		Key: key,
+		Env: "PROTO_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_")),
+		get: func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, value string) error {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", value)
+			}
+			*field(c) = parsed
+			return nil
+		},
+	}
+}
+
+// listSetting builds a Setting for a list of strings, which overrides give
+// as values separated by ;
+func listSetting(key string, field func(*Config) *[]string) Setting {
+	return Setting{
+		Key: key,
+		Env: "PROTO_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_")),
+		get: func(c *Config) string { return strings.Join(*field(c), ";") },
+		set: func(c *Config, value string) error {
+			var items []string
+			for _, item := range strings.Split(value, ";") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*field(c) = items
+			return nil
+		},
+	}
+}
+
+// formatPlugins renders plugin pins as "name=constraint" pairs
+func formatPlugins(plugins map[string]string) string {
+	var pairs []string
+	for name, constraint := range plugins {
+		pairs = append(pairs, name+"="+constraint)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// parsePlugins parses "name=constraint" pairs separated by semicolons
+func parsePlugins(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	plugins := map[string]string{}
+	for _, pair := range strings.Split(value, ";") {
+		name, constraint, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid plugin pin %q, expected name=constraint", pair)
+		}
+		plugins[name] = constraint
+	}
+	return plugins, nil
+}
+
+// LookupSetting returns the setting for a dotted key
+func LookupSetting(key string) (Setting, bool) {
+	for _, setting := range Settings {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Override is a config value set from outside .protorc
+type Override struct {
+	Key    string
+	Value  string
+	Origin string
+}
+
+// Origin describes where the effective value of a key came from
+func (c *Config) Origin(key string) string {
+	if origin, ok := c.origins[key]; ok {
+		return origin
+	}
+	return "default"
+}
+
+// Apply layers overrides on top of the config, recording their origin. The
+// result is validated again, so an override cannot produce a config the file
+// form would reject, such as a path next to a configured github_url.
+func (c *Config) Apply(overrides []Override) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	var origins []string
+	for _, override := range overrides {
+		origins = append(origins, override.Origin)
+		setting, ok := LookupSetting(override.Key)
+		if !ok {
+			return fmt.Errorf("unknown config key %q", override.Key)
+		}
+		if err := setting.Set(c, override.Value); err != nil {
+			return fmt.Errorf("invalid value for %s from %s: %v", override.Key, override.Origin, err)
+		}
+		if c.origins == nil {
+			c.origins = map[string]string{}
+		}
+		c.origins[override.Key] = override.Origin
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid config after applying overrides from %s: %v", strings.Join(origins, ", "), err)
+	}
+	return nil
+}
+
+// EnvOverrides returns an override for every setting whose environment
+// variable is set to a non-empty value
+func EnvOverrides() []Override {
+	var overrides []Override
+	for _, setting := range Settings {
+		if value := os.Getenv(setting.Env); value != "" {
+			overrides = append(overrides, Override{
+				Key:    setting.Key,
+				Value:  value,
+				Origin: "env " + setting.Env,
+			})
+		}
+	}
+	return overrides
+}
@@ -0,0 +1,121 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigOverridePrecedence(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	protorc := "github_url: https://github.com/example/repo\nbranch: main\nremote_path: api\nproto_dir: ./proto\npython:\n  pyproject: false\n"
+	if err := os.WriteFile(filepath.Join(tempDir, ".protorc"), []byte(protorc), 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+
+	for key, value := range map[string]string{
+		"PROTO_BRANCH":            "ci",
+		"PROTO_REMOTE_PATH":       "from-env",
+		"PROTO_BUILD_DIR":         "./out",
+		"PROTO_TOOLCHAIN_PLUGINS": "protoc-gen-go=1.34;protoc-gen-go-grpc=>=1.3, <2",
+	} {
+		original, had := os.LookupEnv(key)
+		os.Setenv(key, value)
+		if had {
+			defer os.Setenv(key, original)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if err := config.Apply([]Override{{Key: "remote_path", Value: "from-flag", Origin: "flag --remote-path"}}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		origin string
+	}{
+		{key: "github_url", value: "https://github.com/example/repo", origin: filepath.Join(tempDir, ".protorc")},
+		{key: "branch", value: "ci", origin: "env PROTO_BRANCH"},
+		{key: "remote_path", value: "from-flag", origin: "flag --remote-path"},
+		{key: "build_dir", value: "./out", origin: "env PROTO_BUILD_DIR"},
+		{key: "toolchain.plugins", value: "protoc-gen-go-grpc=>=1.3, <2;protoc-gen-go=1.34", origin: "env PROTO_TOOLCHAIN_PLUGINS"},
+		{key: "toolchain.protoc", value: "", origin: "default"},
+		{key: "verify_signatures", value: "false", origin: "default"},
+		{key: "python.pyproject", value: "false", origin: filepath.Join(tempDir, ".protorc")},
+	}
+	for _, tt := range tests {
+		setting, ok := LookupSetting(tt.key)
+		if !ok {
+			t.Fatalf("LookupSetting(%q) not found", tt.key)
+		}
+		if got := setting.Get(config); got != tt.value {
+			t.Errorf("%s = %q, want %q", tt.key, got, tt.value)
+		}
+		if got := config.Origin(tt.key); got != tt.origin {
+			t.Errorf("Origin(%s) = %q, want %q", tt.key, got, tt.origin)
+		}
+	}
+	if config.Toolchain.Constraint("protoc-gen-go-grpc") != ">=1.3, <2" {
+		t.Errorf("Constraint(protoc-gen-go-grpc) = %q, want %q", config.Toolchain.Constraint("protoc-gen-go-grpc"), ">=1.3, <2")
+	}
+
+	if err := config.Apply([]Override{{Key: "no_such_key", Value: "x", Origin: "test"}}); err == nil {
+		t.Error("Apply() error = nil, want error for unknown key")
+	}
+}
+
+func TestOverridesValidated(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	protorc := "github_url: https://github.com/example/repo\nproto_dir: ./proto\n"
+	if err := os.WriteFile(filepath.Join(tempDir, ".protorc"), []byte(protorc), 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+
+	// PROTO_PATH usually lists include paths and must not switch the source
+	original, had := os.LookupEnv("PROTO_PATH")
+	os.Setenv("PROTO_PATH", "/usr/include")
+	if had {
+		defer os.Setenv("PROTO_PATH", original)
+	} else {
+		defer os.Unsetenv("PROTO_PATH")
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.SourceKind() != "git" || config.LocalPath != "" {
+		t.Errorf("LoadConfig() source = %s %q, want github_url to be used", config.SourceKind(), config.LocalPath)
+	}
+
+	// Overrides are held to the same rules as the file
+	err = config.Apply([]Override{{Key: "path", Value: "./local", Origin: "flag --path"}})
+	if err == nil || !strings.Contains(err.Error(), "flag --path") || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("Apply() error = %v, want the path flag rejected next to github_url", err)
+	}
+
+	os.Setenv("PROTO_SOURCE_PATH", "./local")
+	defer os.Unsetenv("PROTO_SOURCE_PATH")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "env PROTO_SOURCE_PATH") {
+		t.Errorf("LoadConfig() error = %v, want PROTO_SOURCE_PATH rejected next to github_url", err)
+	}
+}
@@ -0,0 +1,311 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatusOptions holds the optional settings for Status
+type StatusOptions struct {
+	// Offline skips asking repositories for their latest commit
+	Offline bool
+}
+
+// StatusReport describes how current the synced files and generated code are
+type StatusReport struct {
+	// Sources lists the main source followed by each dependency
+	Sources []SourceStatus
+	// LocalChanges lists synced files modified, deleted or added since
+	// their sync
+	LocalChanges []FileChange
+	Build        BuildStatus
+	// Tools lists the resolved versions of protoc and the plugins of every
+	// generation target
+	Tools []ToolStatus
+}
+
+// Outdated reports whether a source has changed upstream since it was synced,
+// or the generated code is older than the proto files
+func (r *StatusReport) Outdated() bool {
+	for _, source := range r.Sources {
+		if source.Outdated() {
+			return true
+		}
+	}
+	return r.Build.Stale()
+}
+
+// Failed reports whether a source could not be checked, so the report does
+// not show whether it is current
+func (r *StatusReport) Failed() bool {
+	for _, source := range r.Sources {
+		if source.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Dirty reports whether synced files were changed locally
+func (r *StatusReport) Dirty() bool {
+	return len(r.LocalChanges) > 0
+}
+
+// SourceStatus compares one source's last sync with its upstream
+type SourceStatus struct {
+	// Name is the dependency name, empty for the main source
+	Name     string
+	Kind     string
+	Location string
+	Dir      string
+	// Synced is false if nothing has been synced into Dir
+	Synced      bool
+	SyncedHead  string
+	ContentHash string
+	SyncedAt    time.Time
+	// RemoteHead is the commit the synced branch points at upstream. It is
+	// empty for sources without commits and when the check was skipped.
+	RemoteHead string
+	// Changed is set when the source was checked and no longer matches the
+	// synced files
+	Changed bool
+	// Err explains why the source could not be checked
+	Err error
+}
+
+// Outdated reports whether the source needs a sync
+func (s SourceStatus) Outdated() bool {
+	return !s.Synced || s.Changed
+}
+
+// BuildStatus compares the generated code in BuildDir with the proto files it
+// was generated from
+type BuildStatus struct {
+	Dir string
+	// Targets lists the SDK types generated into Dir
+	Targets []string
+	// GeneratedAt is when code was last generated, zero if never
+	GeneratedAt time.Time
+	// Newer lists the proto files changed since code was last generated
+	Newer []string
+}
+
+// Stale reports whether code needs to be generated again
+func (b BuildStatus) Stale() bool {
+	return b.GeneratedAt.IsZero() || len(b.Newer) > 0
+}
+
+// Status reports, without changing anything, whether each source has moved on
+// since it was synced, whether the synced files were edited, whether the
+// generated code is older than the proto files, and which tools generation
+// would use. Repositories are checked with git ls-remote unless
+// opts.Offline is set; local directories are hashed; archives are compared
+// by URL.
+func Status(config *Config, opts StatusOptions) (*StatusReport, error) {
+	report := &StatusReport{}
+
+	provided := map[string]bool{}
+	for _, dep := range config.Deps {
+		status, err := sourceStatus(config, dep.Source, config.DepPath(dep.Name), opts, nil)
+		if err != nil {
+			return nil, err
+		}
+		status.Name = dep.Name
+		report.Sources = append(report.Sources, status)
+		if provenance, _ := LoadProvenance(config.DepPath(dep.Name)); provenance != nil {
+			for _, entry := range provenance.Files {
+				provided[entry.File] = true
+			}
+		}
+	}
+	main, err := sourceStatus(config, config.Source(), config.ProtoPath(), opts, provided)
+	if err != nil {
+		return nil, err
+	}
+	report.Sources = append([]SourceStatus{main}, report.Sources...)
+
+	for _, synced := range syncedDirs(config) {
+		provenance, err := LoadProvenance(synced.dir)
+		if err != nil {
+			return nil, err
+		}
+		if provenance == nil {
+			continue
+		}
+		changes, err := verifyDir(synced, provenance)
+		if err != nil {
+			return nil, err
+		}
+		report.LocalChanges = append(report.LocalChanges, changes...)
+	}
+	sort.SliceStable(report.LocalChanges, func(i, j int) bool {
+		return report.LocalChanges[i].File < report.LocalChanges[j].File
+	})
+
+	if report.Build, err = buildStatus(config); err != nil {
+		return nil, err
+	}
+
+	tools := []string{"protoc"}
+	seen := map[string]bool{"protoc": true}
+	for _, target := range []string{"go", "python"} {
+		for _, tool := range TargetTools[target] {
+			if !seen[tool] {
+				seen[tool] = true
+				tools = append(tools, tool)
+			}
+		}
+	}
+	for _, tool := range config.Toolchain.Pinned() {
+		if !seen[tool] {
+			seen[tool] = true
+			tools = append(tools, tool)
+		}
+	}
+	report.Tools = CheckToolchain(config.Toolchain, tools, config.Toolchain.LookPath)
+	return report, nil
+}
+
+// sourceStatus reads the sync state of destDir and checks whether source has
+// changed since. Problems reaching the source are recorded in the status
+// rather than returned.
+func sourceStatus(config *Config, source Source, destDir string, opts StatusOptions, provided map[string]bool) (SourceStatus, error) {
+	status := SourceStatus{Kind: source.Kind(), Location: sourceLocation(source), Dir: destDir}
+	state, err := readSyncState(destDir)
+	if err != nil {
+		return status, err
+	}
+	provenance, err := LoadProvenance(destDir)
+	if err != nil {
+		return status, err
+	}
+	status.Synced = state.ContentHash != ""
+	status.SyncedHead = state.GitHead
+	status.ContentHash = state.ContentHash
+	if provenance != nil && len(provenance.Files) > 0 {
+		status.SyncedAt = provenance.Files[0].SyncedAt
+	}
+	if !status.Synced {
+		return status, nil
+	}
+
+	switch status.Kind {
+	case "git":
+		if opts.Offline {
+			return status, nil
+		}
+		status.RemoteHead, status.Err = remoteHead(source.Auth, source)
+		status.Changed = status.Err == nil && status.RemoteHead != state.GitHead
+	case "path":
+		hash, err := localSourceHash(config, source, provided)
+		if err != nil {
+			status.Err = err
+			return status, nil
+		}
+		status.Changed = hash != state.ContentHash
+	case "archive":
+		// Archives have no cheap way to ask for a newer version, but a
+		// changed URL means a different release was configured
+		if provenance != nil && len(provenance.Files) > 0 {
+			status.Changed = provenance.Files[0].Source != status.Location
+		}
+	}
+	return status, nil
+}
+
+// remoteHead asks the repository which commit the source's branch, or its
+// default branch, points at
+func remoteHead(auth Auth, source Source) (string, error) {
+	git, err := NewGit(auth, source.GitHubURL)
+	if err != nil {
+		return "", fmt.Errorf("error configuring authentication: %v", err)
+	}
+	ref := "HEAD"
+	if source.Branch != "" {
+		ref = "refs/heads/" + source.Branch
+	}
+	output, err := git.Run("ls-remote", "--quiet", source.GitHubURL, ref)
+	if err != nil {
+		return "", &CloneError{URL: source.GitHubURL, Err: err}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if hash, name, ok := strings.Cut(line, "\t"); ok && name == ref {
+			return hash, nil
+		}
+	}
+	return "", &CloneError{URL: source.GitHubURL, Err: fmt.Errorf("branch %q not found", source.Branch)}
+}
+
+// localSourceHash returns the content hash a sync of a local directory
+// source would record
+func localSourceHash(config *Config, source Source, provided map[string]bool) (string, error) {
+	root, _, cleanup, err := fetchSource(config, source, SyncOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	sourceDir := root
+	if source.RemotePath != "" {
+		sourceDir = filepath.Join(root, strings.Trim(source.RemotePath, `"'`))
+		if info, err := os.Stat(sourceDir); err != nil || !info.IsDir() {
+			return "", &MissingPathError{Key: "remote_path", Path: source.RemotePath, Tree: describeTree(root)}
+		}
+	}
+	files, _, err := selectFiles(config, source, sourceDir, provided)
+	if err != nil {
+		return "", err
+	}
+	return hashFiles(sourceDir, files)
+}
+
+// buildStatus compares the generation manifest's modification time, which
+// gen writes after generating successfully, with the proto files in ProtoDir
+// and the dependency vendor directories
+func buildStatus(config *Config) (BuildStatus, error) {
+	status := BuildStatus{Dir: config.BuildPath()}
+	info, err := os.Stat(getGenManifestPath(status.Dir))
+	if os.IsNotExist(err) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("error reading generation manifest: %v", err)
+	}
+	status.GeneratedAt = info.ModTime()
+
+	manifest, err := LoadGenManifest(status.Dir)
+	if err != nil {
+		return status, err
+	}
+	for target := range manifest.Targets {
+		status.Targets = append(status.Targets, target)
+	}
+	sort.Strings(status.Targets)
+
+	for _, synced := range syncedDirs(config) {
+		files, err := findProtoFiles(synced.dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return status, fmt.Errorf("error searching for proto files: %v", err)
+		}
+		for _, file := range files {
+			info, err := os.Stat(filepath.Join(synced.dir, filepath.FromSlash(file)))
+			if err != nil {
+				return status, fmt.Errorf("error reading proto file %s: %v", file, err)
+			}
+			if info.ModTime().After(status.GeneratedAt) {
+				if synced.label != "" {
+					file = synced.label + "/" + file
+				}
+				status.Newer = append(status.Newer, file)
+			}
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,116 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	bare, work := createRepo(t, tempDir, map[string]string{
+		"protos/api/service.proto": "syntax = \"proto3\";\n",
+	})
+	writeFiles(t, tempDir, map[string]string{"googleapis/google/api/http.proto": "syntax = \"proto3\";\n"})
+	config := &Config{
+		GitHubURL:  "file://" + bare,
+		Branch:     "main",
+		RemotePath: "protos",
+		ProtoDir:   "./proto",
+		BuildDir:   "./gen",
+		Deps:       []Dependency{{Name: "googleapis", Source: Source{LocalPath: "googleapis"}}},
+		path:       filepath.Join(tempDir, ConfigFileName),
+	}
+
+	report, err := Status(config, StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if report.Sources[0].Synced || !report.Outdated() || report.Dirty() {
+		t.Errorf("Status() before sync = %+v, want unsynced and outdated", report)
+	}
+
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	// Generated code newer than every proto file
+	if err := os.MkdirAll(config.BuildPath(), 0755); err != nil {
+		t.Fatalf("Failed to create build dir: %v", err)
+	}
+	manifest := &GenManifest{Targets: map[string]GenTarget{"go": {}}}
+	if err := SaveGenManifest(config.BuildPath(), manifest); err != nil {
+		t.Fatalf("SaveGenManifest() error = %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(getGenManifestPath(config.BuildPath()), later, later); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	report, err = Status(config, StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	main := report.Sources[0]
+	if main.SyncedHead != result.Revision || main.RemoteHead != result.Revision || main.Err != nil {
+		t.Errorf("Status() main source = %+v, want synced and remote head %s", main, result.Revision)
+	}
+	if report.Outdated() || report.Dirty() {
+		t.Errorf("Status() after sync = %+v, want up to date and clean", report)
+	}
+	if !reflect.DeepEqual(report.Build.Targets, []string{"go"}) {
+		t.Errorf("Status() build targets = %v, want [go]", report.Build.Targets)
+	}
+	if len(report.Tools) == 0 || report.Tools[0].Name != "protoc" {
+		t.Errorf("Status() tools = %+v, want protoc first", report.Tools)
+	}
+
+	head := commitFiles(t, work, bare, "Add user", map[string]string{"protos/api/user.proto": "syntax = \"proto3\";\n"})
+	writeFiles(t, tempDir, map[string]string{"googleapis/google/api/annotations.proto": "syntax = \"proto3\";\n"})
+	report, err = Status(config, StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if report.Sources[0].RemoteHead != head || !report.Sources[0].Changed {
+		t.Errorf("Status() main source = %+v, want remote head %s and changed", report.Sources[0], head)
+	}
+	if !report.Sources[1].Changed {
+		t.Errorf("Status() dependency = %+v, want changed", report.Sources[1])
+	}
+
+	report, err = Status(config, StatusOptions{Offline: true})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if report.Sources[0].RemoteHead != "" || report.Sources[0].Changed {
+		t.Errorf("Status() offline main source = %+v, want the remote left unchecked", report.Sources[0])
+	}
+
+	writeFiles(t, tempDir, map[string]string{"proto/api/service.proto": "syntax = \"proto2\";\n"})
+	edited := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(tempDir, "proto", "api", "service.proto"), edited, edited); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	report, err = Status(config, StatusOptions{Offline: true})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !report.Dirty() || !reflect.DeepEqual(report.LocalChanges, []FileChange{{File: "api/service.proto", Status: "modified"}}) {
+		t.Errorf("Status() local changes = %v, want api/service.proto modified", report.LocalChanges)
+	}
+	if !reflect.DeepEqual(report.Build.Newer, []string{"api/service.proto"}) || !report.Build.Stale() {
+		t.Errorf("Status() build = %+v, want stale because of api/service.proto", report.Build)
+	}
+}
@@ -0,0 +1,745 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncOptions controls a sync
+type SyncOptions struct {
+	// DryRun selects the files and reports what would change without copying
+	// anything or updating the cache
+	DryRun bool
+	// Offline uses only cached mirrors and archives, without network access
+	Offline bool
+	// Force overwrites files edited locally since the last sync, and
+	// restores them even if the source has not changed
+	Force bool
+	// Bundle restores the sources from a bundle written by ExportBundle
+	// instead of fetching them
+	Bundle string
+	// BundleSHA256 is the expected sha256 of Bundle, required to import it
+	BundleSHA256 string
+}
+
+// PatternMatch lists the proto files an include or exclude pattern matched
+type PatternMatch struct {
+	// Kind is "include", "exclude" or "root"
+	Kind    string
+	Pattern string
+	Files   []string
+}
+
+// SyncResult describes what a sync did
+type SyncResult struct {
+	// Revision is the synced commit, empty for path and archive sources
+	Revision string
+	// ContentHash identifies the synced set of files and their contents
+	ContentHash string
+	// Files lists the synced files relative to ProtoDir, in slash form
+	Files []string
+	// Changed lists the files this sync added or modified, in the same form
+	Changed []string
+	// UpToDate is set when the source matched the last sync and nothing was
+	// copied
+	UpToDate bool
+	// LocalChanges lists files edited or deleted locally that were left
+	// alone because the source has not changed. In a dry run of a changed
+	// source it lists the edited files a sync would refuse to overwrite.
+	LocalChanges []string
+	// Removed lists the files the last sync wrote that are no longer synced
+	// and were deleted
+	Removed []string
+	// Orphaned lists the files the last sync wrote that are no longer synced
+	// but were kept because they were edited locally
+	Orphaned []string
+	// Changelog describes the upstream changes when a repository moved to a
+	// new commit since the last sync
+	Changelog *Changelog
+	// Matches lists what each include and exclude pattern matched
+	Matches []PatternMatch
+
+	// Name is the dependency the result is for, empty for the main source
+	Name string
+	// Deps holds the results for each dependency
+	Deps []*SyncResult
+	// Unresolved lists imports that no synced file provides
+	Unresolved []UnresolvedImport
+}
+
+// CloneError reports a repository that could not be cloned
+type CloneError struct {
+	URL string
+	Err error
+}
+
+func (e *CloneError) Error() string {
+	return fmt.Sprintf("error cloning repository %s: %v", RedactURL(e.URL), e.Err)
+}
+
+func (e *CloneError) Unwrap() error {
+	return e.Err
+}
+
+// MissingPathError reports a configured directory, such as remote_path, that
+// does not exist in the source. Tree lists the source's contents to help spot
+// the right path.
+type MissingPathError struct {
+	Key  string
+	Path string
+	Tree string
+}
+
+func (e *MissingPathError) Error() string {
+	return fmt.Sprintf("%s '%s' does not exist in the source", e.Key, e.Path)
+}
+
+// NoProtoFilesError reports a source directory without any .proto files.
+// Tree lists the directory's contents.
+type NoProtoFilesError struct {
+	Dir  string
+	Tree string
+}
+
+func (e *NoProtoFilesError) Error() string {
+	return fmt.Sprintf("no proto files found in %s", e.Dir)
+}
+
+// LocalChangesError reports synced files that were edited locally and would
+// be overwritten by a sync
+type LocalChangesError struct {
+	Dir   string
+	Files []string
+}
+
+func (e *LocalChangesError) Error() string {
+	return fmt.Sprintf("%d file(s) in %s were modified locally and would be overwritten: %s", len(e.Files), e.Dir, strings.Join(e.Files, ", "))
+}
+
+// SignatureError reports a commit that does not carry a valid signature from
+// a trusted key
+type SignatureError struct {
+	URL    string
+	Commit string
+	Err    error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("commit %s of %s failed signature verification: %v", e.Commit, RedactURL(e.URL), e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// Source is a place proto files are synced from. Exactly one of GitHubURL,
+// LocalPath and Archive.URL is set.
+type Source struct {
+	GitHubURL  string        `yaml:"github_url,omitempty"`
+	LocalPath  string        `yaml:"path,omitempty"`
+	Archive    ArchiveSource `yaml:"archive,omitempty"`
+	Branch     string        `yaml:"branch,omitempty"`
+	RemotePath string        `yaml:"remote_path,omitempty"`
+	Include    []string      `yaml:"include,omitempty"`
+	Exclude    []string      `yaml:"exclude,omitempty"`
+	// Roots limits the sync to these files, directories or proto packages
+	// and everything they transitively import
+	Roots []string `yaml:"roots,omitempty"`
+	// VerifySignatures requires the synced commit of a repository to carry a
+	// valid GPG or SSH signature
+	VerifySignatures bool `yaml:"verify_signatures,omitempty"`
+	// AllowedSigners is the SSH allowed signers file signatures are checked
+	// against, relative to .protorc. Without it git's own configuration
+	// decides which keys are trusted.
+	AllowedSigners string `yaml:"allowed_signers,omitempty"`
+	// Auth holds the credentials for a repository. A dependency only gets
+	// the credentials configured on it, never those of the main source.
+	Auth Auth `yaml:"auth,omitempty"`
+}
+
+// Kind returns how the source is fetched: "path" for a local directory,
+// "archive" for a release archive, "git" for a repository, or "" if the
+// source is empty
+func (s Source) Kind() string {
+	switch {
+	case s.LocalPath != "":
+		return "path"
+	case s.Archive.URL != "":
+		return "archive"
+	case s.GitHubURL != "":
+		return "git"
+	}
+	return ""
+}
+
+// Sync copies the .proto files under RemotePath of the configured source into
+// ProtoDir, keeping those selected by the Include and Exclude patterns, and
+// then syncs each dependency into its vendor directory. A source is skipped
+// when its files' content hash matches the last one recorded in its cache, so
+// sources without commits, such as a local directory, are change-detected the
+// same way as repositories. With opts.Bundle set, the files and sync state
+// are restored from a bundle instead of being fetched. The pre_sync and
+// post_sync hooks run around it, except for dry runs.
+func Sync(config *Config, opts SyncOptions) (*SyncResult, error) {
+	if !opts.DryRun {
+		if err := RunHooks(config, HookPreSync, HookContext{}); err != nil {
+			return nil, err
+		}
+	}
+
+	var result *SyncResult
+	var err error
+	if opts.Bundle != "" {
+		result, err = importBundle(config, opts)
+	} else {
+		result, err = syncAll(config, opts)
+	}
+	if err != nil || opts.DryRun {
+		return result, err
+	}
+
+	var changed []string
+	for _, file := range result.Changed {
+		changed = append(changed, filepath.Join(config.ProtoPath(), filepath.FromSlash(file)))
+	}
+	for _, dep := range result.Deps {
+		for _, file := range dep.Changed {
+			changed = append(changed, filepath.Join(config.DepPath(dep.Name), filepath.FromSlash(file)))
+		}
+	}
+	if err := RunHooks(config, HookPostSync, HookContext{Revision: result.Revision, Changed: changed}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// syncAll syncs the dependencies and then the main source
+func syncAll(config *Config, opts SyncOptions) (*SyncResult, error) {
+	// Dependencies go first so the main source's roots can import from them
+	provided := map[string]bool{}
+	var deps []*SyncResult
+	for _, dep := range config.Deps {
+		depResult, err := syncSource(config, dep.Source, config.DepPath(dep.Name), opts, nil)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %w", dep.Name, err)
+		}
+		depResult.Name = dep.Name
+		deps = append(deps, depResult)
+		for _, file := range depResult.Files {
+			provided[file] = true
+		}
+	}
+
+	result, err := syncSource(config, config.Source(), config.ProtoPath(), opts, provided)
+	if err != nil {
+		return nil, err
+	}
+	result.Deps = deps
+
+	if !opts.DryRun {
+		if result.Unresolved, err = FindUnresolvedImports(config); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// syncSource copies the selected .proto files of one source into destDir.
+// provided lists files available from dependencies, which imports reachable
+// from the source's roots may refer to.
+func syncSource(config *Config, source Source, destDir string, opts SyncOptions, provided map[string]bool) (*SyncResult, error) {
+	root, revision, cleanup, err := fetchSource(config, source, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	sourceDir := root
+	if source.RemotePath != "" {
+		// Remove any quotes from the remote path
+		cleanPath := strings.Trim(source.RemotePath, `"'`)
+		sourceDir = filepath.Join(root, cleanPath)
+		if info, err := os.Stat(sourceDir); err != nil || !info.IsDir() {
+			return nil, &MissingPathError{Key: "remote_path", Path: source.RemotePath, Tree: describeTree(root)}
+		}
+	}
+
+	files, matches, err := selectFiles(config, source, sourceDir, provided)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashFiles(sourceDir, files)
+	if err != nil {
+		return nil, err
+	}
+	digests, err := digestFiles(sourceDir, files)
+	if err != nil {
+		return nil, err
+	}
+	result := &SyncResult{Revision: revision, ContentHash: hash, Files: files, Matches: matches}
+
+	// Read what was synced before installing overwrites it
+	previous, _ := readSyncState(destDir)
+	state := SyncState{GitHead: revision, ContentHash: hash, PreviousHead: previous.PreviousHead}
+	if previous.GitHead != revision {
+		state.PreviousHead = previous.GitHead
+	}
+	oldFiles := files
+	if provenance, err := LoadProvenance(destDir); err == nil && provenance != nil {
+		oldFiles = nil
+		for _, entry := range provenance.Files {
+			oldFiles = append(oldFiles, entry.File)
+		}
+	}
+
+	// The changelog is built before installing, since once the new head is
+	// recorded a failed attempt could not be retried
+	var changelog *Changelog
+	if source.Kind() == "git" && config.Changelog != "none" && previous.GitHead != "" && previous.GitHead != revision {
+		if changelog, err = buildChangelog(&Git{}, filepath.Join(root, ".git"), source, previous.GitHead, revision, oldFiles, files); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := installFiles(sourceDir, destDir, digests, state, newProvenance(source, revision, digests), opts, result); err != nil {
+		return nil, err
+	}
+
+	if changelog != nil && !result.UpToDate {
+		result.Changelog = changelog
+		if config.Changelog == "file" && !opts.DryRun {
+			if err := writeChangesFile(destDir, result.Changelog); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// selectFiles returns the .proto files under sourceDir that the source's
+// include, exclude and roots settings select
+func selectFiles(config *Config, source Source, sourceDir string, provided map[string]bool) ([]string, []PatternMatch, error) {
+	found, err := findProtoFiles(sourceDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error searching for proto files: %v", err)
+	}
+	files, matches, err := filterFiles(found, source.Include, source.Exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(source.Roots) > 0 && len(files) > 0 {
+		var includeDirs []string
+		if include := config.Toolchain.ManagedIncludeDir(); include != "" {
+			includeDirs = append(includeDirs, include)
+		}
+		external := func(imported string) bool {
+			return provided[imported] || resolveImport(imported, includeDirs)
+		}
+		var rootMatches []PatternMatch
+		if files, rootMatches, err = importClosure(sourceDir, files, source.Roots, external); err != nil {
+			return nil, nil, err
+		}
+		matches = append(matches, rootMatches...)
+	}
+	if len(files) == 0 {
+		return nil, nil, &NoProtoFilesError{Dir: sourceDir, Tree: describeTree(sourceDir)}
+	}
+	return files, matches, nil
+}
+
+// installFiles copies the files listed in digests from sourceDir into
+// destDir and records their sync state and provenance. When state matches
+// the directory's cache nothing is copied, and files edited or deleted
+// locally since the last sync are reported in result.LocalChanges instead,
+// unless opts.Force restores them. Files the last sync wrote that are no
+// longer listed are deleted, or reported in result.Orphaned if they were
+// edited. Locally edited files are never overwritten or deleted without
+// opts.Force.
+func installFiles(sourceDir, destDir string, digests map[string]string, state SyncState, provenance *Provenance, opts SyncOptions, result *SyncResult) error {
+	edited, missing, err := localChanges(destDir, digests)
+	if err != nil {
+		return err
+	}
+	removed, orphaned, err := staleFiles(destDir, digests)
+	if err != nil {
+		return err
+	}
+	if opts.Force {
+		removed, orphaned = append(removed, orphaned...), nil
+		sort.Strings(removed)
+	}
+	result.Removed, result.Orphaned = removed, orphaned
+
+	// Without a readable manifest every file counts as changed
+	previous, _ := LoadProvenance(destDir)
+	// Orphaned files stay in the manifest, so later syncs keep reporting
+	// them until they are removed
+	for _, file := range orphaned {
+		entry, _ := previous.Lookup(file)
+		provenance.Files = append(provenance.Files, entry)
+	}
+
+	// An unreadable cache only costs a resync, so it is not an error
+	if cached, err := readSyncState(destDir); err == nil && cached.ContentHash == state.ContentHash {
+		if !opts.Force || len(edited)+len(missing) == 0 {
+			result.UpToDate = true
+			result.LocalChanges = append(edited, missing...)
+			sort.Strings(result.LocalChanges)
+			if opts.DryRun {
+				return nil
+			}
+			if err := removeFiles(destDir, removed); err != nil {
+				return err
+			}
+			// A new revision with the same files is still recorded, so
+			// status compares against the commit actually synced
+			if cached.GitHead != state.GitHead {
+				if err := writeSyncState(destDir, state); err != nil {
+					return err
+				}
+				return writeProvenance(destDir, provenance)
+			}
+			// Directories synced before provenance was recorded get a
+			// manifest without having to be copied again
+			if previous == nil || len(removed) > 0 {
+				return writeProvenance(destDir, provenance)
+			}
+			return nil
+		}
+	} else if len(edited) > 0 && !opts.Force {
+		// A dry run reports what a real sync would refuse to overwrite
+		if opts.DryRun {
+			result.LocalChanges = edited
+			return nil
+		}
+		return &LocalChangesError{Dir: destDir, Files: edited}
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	files := make([]string, 0, len(digests))
+	for file := range digests {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if previous == nil {
+			result.Changed = append(result.Changed, file)
+		} else if entry, ok := previous.Lookup(file); !ok || entry.SHA256 != digests[file] {
+			result.Changed = append(result.Changed, file)
+		}
+		if err := copyFile(filepath.Join(sourceDir, filepath.FromSlash(file)), filepath.Join(destDir, filepath.FromSlash(file))); err != nil {
+			return fmt.Errorf("error syncing proto file %s: %v", file, err)
+		}
+	}
+	if err := removeFiles(destDir, removed); err != nil {
+		return err
+	}
+
+	if err := writeSyncState(destDir, state); err != nil {
+		return err
+	}
+	return writeProvenance(destDir, provenance)
+}
+
+// fetchSource makes a source available on disk. It returns the source's root
+// directory, its revision if it has one, and a function that removes anything
+// fetched.
+func fetchSource(config *Config, source Source, opts SyncOptions) (string, string, func(), error) {
+	noop := func() {}
+	switch source.Kind() {
+	case "path":
+		root := config.ResolvePath(source.LocalPath)
+		info, err := os.Stat(root)
+		if err != nil {
+			return "", "", noop, fmt.Errorf("error reading source path: %v", err)
+		}
+		if !info.IsDir() {
+			return "", "", noop, fmt.Errorf("source path %s is not a directory", root)
+		}
+		return root, "", noop, nil
+	case "archive":
+		location := source.Archive.URL
+		if !strings.Contains(location, "://") {
+			location = config.ResolvePath(location)
+		}
+		root, err := fetchArchive(source.Archive, location, opts.Offline)
+		return root, "", noop, err
+	case "git":
+		if source.AllowedSigners != "" {
+			source.AllowedSigners = config.ResolvePath(source.AllowedSigners)
+		}
+		return cloneSource(source.Auth, source, opts.Offline)
+	}
+	return "", "", noop, fmt.Errorf("no source configured, set github_url, path or archive.url")
+}
+
+// cloneSource checks out a repository into a temporary directory from its
+// cached mirror, updating the mirror first unless offline
+func cloneSource(auth Auth, source Source, offline bool) (string, string, func(), error) {
+	noop := func() {}
+	git, err := NewGit(auth, source.GitHubURL)
+	if err != nil {
+		return "", "", noop, fmt.Errorf("error configuring authentication: %v", err)
+	}
+
+	mirror, unlock, err := updateMirror(git, source.GitHubURL, offline)
+	if err != nil {
+		return "", "", noop, err
+	}
+	defer unlock()
+
+	ref := "HEAD"
+	if source.Branch != "" {
+		ref = "refs/heads/" + source.Branch
+	}
+	revision, err := git.Run("--git-dir", mirror, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", "", noop, &CloneError{URL: source.GitHubURL, Err: fmt.Errorf("branch %q not found", source.Branch)}
+	}
+	if source.VerifySignatures {
+		if err := verifyCommit(git, mirror, revision, source.AllowedSigners); err != nil {
+			return "", "", noop, &SignatureError{URL: source.GitHubURL, Commit: revision, Err: err}
+		}
+	}
+
+	tempDir, err := os.MkdirTemp("", "proto-sync-*")
+	if err != nil {
+		return "", "", noop, fmt.Errorf("error creating temp directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(tempDir) }
+
+	// A shared clone borrows the mirror's objects, so checking out is cheap
+	if _, err := git.Run("clone", "--quiet", "--shared", "--no-checkout", mirror, tempDir); err != nil {
+		cleanup()
+		return "", "", noop, fmt.Errorf("error checking out from mirror: %v", err)
+	}
+	git.Dir = tempDir
+	if _, err := git.Run("checkout", "--quiet", "--detach", revision); err != nil {
+		cleanup()
+		return "", "", noop, fmt.Errorf("error checking out from mirror: %v", err)
+	}
+	return tempDir, revision, cleanup, nil
+}
+
+// verifyCommit checks the signature of a commit in a bare repository with git
+// verify-commit, using allowedSigners for SSH signatures if set
+func verifyCommit(git *Git, gitDir, revision, allowedSigners string) error {
+	args := []string{"--git-dir", gitDir}
+	if allowedSigners != "" {
+		abs, err := filepath.Abs(allowedSigners)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return fmt.Errorf("allowed_signers: %v", err)
+		}
+		args = append(args, "-c", "gpg.ssh.allowedSignersFile="+abs)
+	}
+	_, err := git.Run(append(args, "verify-commit", revision)...)
+	return err
+}
+
+// findProtoFiles returns the .proto files under dir relative to it, sorted
+// and in slash form
+func findProtoFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".proto") {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// GenFiles returns the proto files gen generates code for: every .proto file
+// under ProtoDir, relative to it and in slash form. A vendor directory placed
+// inside ProtoDir is skipped, since dependencies are only imported.
+func GenFiles(config *Config) ([]string, error) {
+	protoDir := config.ProtoPath()
+	all, err := findProtoFiles(protoDir)
+	if err != nil {
+		return nil, err
+	}
+	vendorPrefix := ""
+	absProto, protoErr := filepath.Abs(protoDir)
+	absVendor, vendorErr := filepath.Abs(config.VendorPath())
+	if protoErr == nil && vendorErr == nil {
+		if rel, err := filepath.Rel(absProto, absVendor); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			vendorPrefix = filepath.ToSlash(rel) + "/"
+		}
+	}
+	var files []string
+	for _, file := range all {
+		if vendorPrefix == "" || !strings.HasPrefix(file, vendorPrefix) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// filterFiles keeps the files matched by at least one include pattern, or
+// every file if there are none, and by no exclude pattern. A pattern matching
+// a directory applies to every file below it. It also returns what each
+// pattern matched.
+func filterFiles(files, include, exclude []string) ([]string, []PatternMatch, error) {
+	var matches []PatternMatch
+	for _, pattern := range include {
+		matches = append(matches, PatternMatch{Kind: "include", Pattern: pattern})
+	}
+	for _, pattern := range exclude {
+		matches = append(matches, PatternMatch{Kind: "exclude", Pattern: pattern})
+	}
+
+	var kept []string
+	for _, file := range files {
+		included, excluded := len(include) == 0, false
+		for i := range matches {
+			if matches[i].Kind == "exclude" && !included {
+				break
+			}
+			matched, err := matchPath(matches[i].Pattern, file)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", matches[i].Kind, err)
+			}
+			if !matched {
+				continue
+			}
+			matches[i].Files = append(matches[i].Files, file)
+			if matches[i].Kind == "include" {
+				included = true
+			} else {
+				excluded = true
+			}
+		}
+		if included && !excluded {
+			kept = append(kept, file)
+		}
+	}
+	return kept, matches, nil
+}
+
+// matchPath reports whether pattern matches file or one of its parent
+// directories
+func matchPath(pattern, file string) (bool, error) {
+	for name := file; name != "."; name = path.Dir(name) {
+		matched, err := MatchGlob(pattern, name)
+		if matched || err != nil {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// hashFiles returns a sha256 over the names and contents of files under dir
+func hashFiles(dir string, files []string) (string, error) {
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return "", fmt.Errorf("error reading proto file %s: %v", file, err)
+		}
+		// Length-prefix both parts so different file sets cannot collide
+		fmt.Fprintf(h, "%d:%s%d:", len(file), file, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// removeFiles deletes files relative to dir along with the directories they
+// leave empty, up to dir itself
+func removeFiles(dir string, files []string) error {
+	root := filepath.Clean(dir)
+	for _, file := range files {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing proto file %s: %v", file, err)
+		}
+		for parent := filepath.Dir(path); parent != root && parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+			if os.Remove(parent) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dest, creating dest's parent directories
+func copyFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// describeTree renders the non-hidden contents of root as an indented
+// listing, for error messages about paths that could not be found
+func describeTree(root string) string {
+	var b strings.Builder
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip the root itself
+		if path == root {
+			return nil
+		}
+		// Skip hidden files and directories
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		// Calculate indentation based on depth
+		depth := strings.Count(relPath, string(os.PathSeparator))
+		indent := strings.Repeat("  ", depth)
+
+		if info.IsDir() {
+			fmt.Fprintf(&b, "%s%s/\n", indent, info.Name())
+		} else {
+			fmt.Fprintf(&b, "%s- %s (%d bytes)\n", indent, info.Name(), info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(&b, "Error walking directory: %v\n", err)
+	}
+	return b.String()
+}
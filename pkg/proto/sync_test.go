@@ -0,0 +1,562 @@
+package proto
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSyncLocalPath(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"upstream/api/v1/service.proto": "syntax = \"proto3\";\n",
+		"upstream/api/README.md":        "not a proto\n",
+	})
+	config := &Config{
+		LocalPath:  "upstream",
+		RemotePath: "api",
+		ProtoDir:   "./proto",
+		path:       filepath.Join(tempDir, ConfigFileName),
+	}
+
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.UpToDate || len(result.Files) != 1 || result.Files[0] != "v1/service.proto" || result.Revision != "" {
+		t.Errorf("Sync() = %+v, want v1/service.proto copied without a revision", result)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "proto", "v1", "service.proto")); err != nil {
+		t.Errorf("synced file missing: %v", err)
+	}
+
+	// Unchanged content is detected by hash
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !result.UpToDate {
+		t.Error("second Sync() UpToDate = false, want true")
+	}
+
+	// Changed content is synced again
+	writeFiles(t, tempDir, map[string]string{"upstream/api/v1/service.proto": "syntax = \"proto3\";\npackage v1;\n"})
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.UpToDate {
+		t.Error("Sync() after change UpToDate = true, want false")
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, "proto", "v1", "service.proto"))
+	if err != nil || string(data) != "syntax = \"proto3\";\npackage v1;\n" {
+		t.Errorf("synced file = %q, %v, want updated content", data, err)
+	}
+
+	// Missing remote paths and sources without protos are reported
+	config.RemotePath = "missing"
+	var missingErr *MissingPathError
+	if _, err := Sync(config, SyncOptions{}); !errors.As(err, &missingErr) {
+		t.Errorf("Sync() error = %v, want MissingPathError", err)
+	}
+	config.RemotePath = ""
+	config.LocalPath = "proto-empty"
+	writeFiles(t, tempDir, map[string]string{"proto-empty/notes.txt": "nothing here\n"})
+	var noFilesErr *NoProtoFilesError
+	if _, err := Sync(config, SyncOptions{}); !errors.As(err, &noFilesErr) {
+		t.Errorf("Sync() error = %v, want NoProtoFilesError", err)
+	}
+}
+
+func TestSyncFilters(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"upstream/api/v1/service.proto":        "syntax = \"proto3\";\n",
+		"upstream/api/v1/internal/debug.proto": "syntax = \"proto3\";\n",
+		"upstream/api/v1alpha1/old.proto":      "syntax = \"proto3\";\n",
+		"upstream/testdata/fixture.proto":      "syntax = \"proto3\";\n",
+	})
+	config := &Config{
+		LocalPath: "upstream",
+		Include:   []string{"api/**"},
+		Exclude:   []string{"**/internal", "**/v1alpha*/**"},
+		ProtoDir:  "./proto",
+		path:      filepath.Join(tempDir, ConfigFileName),
+	}
+
+	result, err := Sync(config, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0] != "api/v1/service.proto" {
+		t.Errorf("Sync() files = %v, want [api/v1/service.proto]", result.Files)
+	}
+	want := map[string]int{"api/**": 3, "**/internal": 1, "**/v1alpha*/**": 1}
+	for _, match := range result.Matches {
+		if len(match.Files) != want[match.Pattern] {
+			t.Errorf("%s %s matched %v, want %d files", match.Kind, match.Pattern, match.Files, want[match.Pattern])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "proto")); !os.IsNotExist(err) {
+		t.Error("dry run wrote to the proto directory")
+	}
+
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	for file, wantSynced := range map[string]bool{
+		"api/v1/service.proto":        true,
+		"api/v1/internal/debug.proto": false,
+		"api/v1alpha1/old.proto":      false,
+		"testdata/fixture.proto":      false,
+	} {
+		_, err := os.Stat(filepath.Join(tempDir, "proto", filepath.FromSlash(file)))
+		if (err == nil) != wantSynced {
+			t.Errorf("%s synced = %v, want %v", file, err == nil, wantSynced)
+		}
+	}
+
+	// Changing the patterns changes the content hash, forcing a resync
+	config.Exclude = nil
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.UpToDate || len(result.Files) != 3 {
+		t.Errorf("Sync() = %+v, want 3 files synced", result)
+	}
+}
+
+func TestSyncRemovesStaleFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"upstream/api/v1/service.proto":        "syntax = \"proto3\";\n",
+		"upstream/api/v1/internal/debug.proto": "syntax = \"proto3\";\n",
+		"upstream/api/v2/user.proto":           "syntax = \"proto3\";\n",
+	})
+	config := &Config{
+		LocalPath: "upstream",
+		Include:   []string{"api/**"},
+		ProtoDir:  "./proto",
+		path:      filepath.Join(tempDir, ConfigFileName),
+	}
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	exists := func(file string) bool {
+		_, err := os.Stat(filepath.Join(tempDir, "proto", filepath.FromSlash(file)))
+		return err == nil
+	}
+
+	// Narrowing include removes the files no longer selected, along with
+	// the directories they leave empty
+	config.Include = []string{"api/v1/**"}
+	result, err := Sync(config, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync() dry run error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"api/v2/user.proto"}) || !exists("api/v2/user.proto") {
+		t.Errorf("Sync() dry run = %+v, want api/v2/user.proto reported but kept", result)
+	}
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"api/v2/user.proto"}) || exists("api/v2/user.proto") || exists("api/v2") {
+		t.Errorf("Sync() = %+v, want api/v2/user.proto removed", result)
+	}
+	if !exists("api/v1/service.proto") || !exists("api/v1/internal/debug.proto") {
+		t.Error("Sync() removed files that are still selected")
+	}
+	if changes, err := Verify(config); err != nil || len(changes) != 0 {
+		t.Errorf("Verify() after removal = %v, %v, want no changes", changes, err)
+	}
+
+	// A file edited locally is reported and kept until --force
+	writeFiles(t, tempDir, map[string]string{"proto/api/v1/internal/debug.proto": "// edited\n"})
+	config.Exclude = []string{"**/internal"}
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if len(result.Removed) != 0 || !reflect.DeepEqual(result.Orphaned, []string{"api/v1/internal/debug.proto"}) || !exists("api/v1/internal/debug.proto") {
+		t.Errorf("Sync() = %+v, want the edited debug.proto kept and reported", result)
+	}
+	if result, err = Sync(config, SyncOptions{}); err != nil || !result.UpToDate || !reflect.DeepEqual(result.Orphaned, []string{"api/v1/internal/debug.proto"}) {
+		t.Errorf("Sync() again = %+v, %v, want debug.proto still reported", result, err)
+	}
+	writeFiles(t, tempDir, map[string]string{"upstream/api/v1/service.proto": "syntax = \"proto3\";\npackage v1;\n"})
+	result, err = Sync(config, SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Sync() with force error = %v", err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"api/v1/internal/debug.proto"}) || exists("api/v1/internal") {
+		t.Errorf("Sync() with force = %+v, want debug.proto removed", result)
+	}
+}
+
+func TestSyncRoots(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"upstream/payments/v2/api.proto": `syntax = "proto3";
+package acme.payments.v2;
+import "payments/v2/types.proto";
+import "common/money.proto";
+import "google/protobuf/timestamp.proto";
+import "google/api/annotations.proto";
+`,
+		"upstream/payments/v2/types.proto":        "syntax = \"proto3\";\npackage acme.payments.v2;\nimport \"common/money.proto\";\n",
+		"upstream/payments/v1/old.proto":          "syntax = \"proto3\";\npackage acme.payments.v1;\n",
+		"upstream/billing/invoice.proto":          "syntax = \"proto3\";\npackage acme.billing;\n",
+		"upstream/common/money.proto":             "syntax = \"proto3\";\npackage acme.common;\n",
+		"upstream/common/unused.proto":            "syntax = \"proto3\";\npackage acme.common;\n",
+		"googleapis/google/api/annotations.proto": "syntax = \"proto3\";\n",
+	})
+	newConfig := func(protoDir string, roots ...string) *Config {
+		return &Config{
+			LocalPath: "upstream",
+			Roots:     roots,
+			ProtoDir:  protoDir,
+			Deps:      []Dependency{{Name: "googleapis", Source: Source{LocalPath: "googleapis"}}},
+			path:      filepath.Join(tempDir, ConfigFileName),
+		}
+	}
+
+	tests := []struct {
+		name  string
+		roots []string
+		want  []string
+	}{
+		{
+			name:  "file",
+			roots: []string{"payments/v2/api.proto"},
+			want:  []string{"common/money.proto", "payments/v2/api.proto", "payments/v2/types.proto"},
+		},
+		{
+			name:  "directory",
+			roots: []string{"payments/v2"},
+			want:  []string{"common/money.proto", "payments/v2/api.proto", "payments/v2/types.proto"},
+		},
+		{
+			name:  "package",
+			roots: []string{"acme.billing"},
+			want:  []string{"billing/invoice.proto"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Sync(newConfig("./proto-"+tt.name, tt.roots...), SyncOptions{})
+			if err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if strings.Join(result.Files, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Sync() files = %v, want %v", result.Files, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(tempDir, "proto-"+tt.name, "payments", "v1")); !os.IsNotExist(err) {
+				t.Error("Sync() copied files that are not reachable from the roots")
+			}
+		})
+	}
+
+	// Without the dependency the import cannot be found
+	config := newConfig("./proto-missing", "payments/v2/api.proto")
+	config.Deps = nil
+	_, err = Sync(config, SyncOptions{})
+	var importErr *ImportNotFoundError
+	if !errors.As(err, &importErr) || importErr.File != "payments/v2/api.proto" || importErr.Import != "google/api/annotations.proto" {
+		t.Fatalf("Sync() error = %v, want ImportNotFoundError for google/api/annotations.proto", err)
+	}
+	if !strings.Contains(err.Error(), "googleapis") {
+		t.Errorf("Sync() error = %v, want it to name the googleapis dependency", err)
+	}
+
+	if _, err := Sync(newConfig("./proto-nope", "nope/v1"), SyncOptions{}); err == nil || !strings.Contains(err.Error(), "nope/v1") {
+		t.Errorf("Sync() error = %v, want an error naming the unmatched root", err)
+	}
+}
+
+func TestSyncFileURL(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	bare, work := createRepo(t, tempDir, map[string]string{"protos/service.proto": "syntax = \"proto3\";\n"})
+	config := &Config{
+		GitHubURL:  "file://" + bare,
+		Branch:     "main",
+		RemotePath: "protos",
+		ProtoDir:   "./proto",
+		path:       filepath.Join(tempDir, ConfigFileName),
+	}
+
+	result, err := Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	head := runGit(t, work, "rev-parse", "HEAD")
+	if result.UpToDate || result.Revision != head {
+		t.Errorf("Sync() = %+v, want revision %s synced", result, head)
+	}
+
+	// A commit that does not touch the protos leaves them up to date
+	previous := head
+	head = commitFiles(t, work, bare, "docs", map[string]string{"README.md": "docs\n"})
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if !result.UpToDate {
+		t.Error("Sync() after unrelated commit UpToDate = false, want true")
+	}
+	// The new commit is still recorded as synced
+	state, err := LoadCache(config)
+	if err != nil {
+		t.Fatalf("LoadCache() error = %v", err)
+	}
+	if state.GitHead != head || state.PreviousHead != previous {
+		t.Errorf("LoadCache() after unrelated commit = %+v, want head %s after %s", state, head, previous)
+	}
+
+	head = commitFiles(t, work, bare, "add message", map[string]string{"protos/message.proto": "syntax = \"proto3\";\n"})
+	result, err = Sync(config, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if result.UpToDate || len(result.Files) != 2 {
+		t.Errorf("Sync() = %+v, want both files synced", result)
+	}
+	state, err = LoadCache(config)
+	if err != nil {
+		t.Fatalf("LoadCache() error = %v", err)
+	}
+	if state.GitHead != head || state.ContentHash != result.ContentHash {
+		t.Errorf("LoadCache() = %+v, want head %s and hash %s", state, head, result.ContentHash)
+	}
+}
+
+func TestSyncArchive(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	archives := filepath.Join(tempDir, "archives")
+	if err := os.MkdirAll(archives, 0755); err != nil {
+		t.Fatalf("Failed to create archive dir: %v", err)
+	}
+	writeTarGz(t, filepath.Join(archives, "protos.tar.gz"), map[string]string{
+		"protos-1.0/proto/api/v1/service.proto": "syntax = \"proto3\";\n",
+		"protos-1.0/proto/api/notes.txt":        "not a proto\n",
+		"protos-1.0/README.md":                  "readme\n",
+	})
+	writeZip(t, filepath.Join(archives, "protos.zip"), map[string]string{
+		"api/v1/service.proto": "syntax = \"proto3\";\n",
+	})
+	writeTarGz(t, filepath.Join(archives, "evil.tar.gz"), map[string]string{
+		"../escape.proto": "syntax = \"proto3\";\n",
+	})
+
+	var requests atomic.Int32
+	files := http.FileServer(http.Dir(archives))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	digest := func(name string) string {
+		sum, err := fileSHA256(filepath.Join(archives, name))
+		if err != nil {
+			t.Fatalf("fileSHA256() error = %v", err)
+		}
+		return sum
+	}
+	newConfig := func(protoDir string, archive ArchiveSource) *Config {
+		return &Config{Archive: archive, ProtoDir: protoDir, path: filepath.Join(tempDir, ConfigFileName)}
+	}
+
+	t.Run("tar.gz over http", func(t *testing.T) {
+		archive := ArchiveSource{
+			URL:         server.URL + "/protos.tar.gz",
+			SHA256:      digest("protos.tar.gz"),
+			StripPrefix: "protos-1.0",
+			Subpath:     "proto",
+		}
+		result, err := Sync(newConfig("./proto-tar", archive), SyncOptions{})
+		if err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if len(result.Files) != 1 || result.Files[0] != "api/v1/service.proto" {
+			t.Errorf("Sync() files = %v, want [api/v1/service.proto]", result.Files)
+		}
+
+		// A second project using the same digest is served from the cache
+		before := requests.Load()
+		if _, err := Sync(newConfig("./proto-tar-2", archive), SyncOptions{}); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if requests.Load() != before {
+			t.Error("Sync() downloaded an archive that was already cached")
+		}
+		if _, err := os.Stat(filepath.Join(tempDir, "proto-tar-2", "api", "v1", "service.proto")); err != nil {
+			t.Errorf("synced file missing: %v", err)
+		}
+	})
+
+	t.Run("zip from a local path", func(t *testing.T) {
+		result, err := Sync(newConfig("./proto-zip", ArchiveSource{URL: "archives/protos.zip", SHA256: digest("protos.zip")}), SyncOptions{})
+		if err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		if len(result.Files) != 1 {
+			t.Errorf("Sync() files = %v, want one file", result.Files)
+		}
+	})
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		wrong := strings.Repeat("0", 64)
+		_, err := Sync(newConfig("./proto-wrong", ArchiveSource{URL: server.URL + "/protos.zip", SHA256: wrong}), SyncOptions{})
+		if err == nil || !strings.Contains(err.Error(), "sha256") {
+			t.Fatalf("Sync() error = %v, want sha256 mismatch", err)
+		}
+		if _, err := os.Stat(filepath.Join(tempDir, "cache", "archives", wrong)); !os.IsNotExist(err) {
+			t.Error("archive with the wrong digest was cached")
+		}
+	})
+
+	t.Run("path traversal", func(t *testing.T) {
+		_, err := Sync(newConfig("./proto-evil", ArchiveSource{URL: server.URL + "/evil.tar.gz", SHA256: digest("evil.tar.gz")}), SyncOptions{})
+		if err == nil {
+			t.Fatal("Sync() error = nil, want error for an entry escaping the archive")
+		}
+		if _, err := os.Stat(filepath.Join(tempDir, "cache", "escape.proto")); !os.IsNotExist(err) {
+			t.Error("archive entry was written outside the cache")
+		}
+	})
+
+	t.Run("missing subpath", func(t *testing.T) {
+		_, err := Sync(newConfig("./proto-missing", ArchiveSource{URL: server.URL + "/protos.tar.gz", SHA256: digest("protos.tar.gz"), Subpath: "nope"}), SyncOptions{})
+		var missingErr *MissingPathError
+		if !errors.As(err, &missingErr) || missingErr.Key != "archive.subpath" {
+			t.Errorf("Sync() error = %v, want MissingPathError for archive.subpath", err)
+		}
+	})
+}
+
+func TestSyncVerifySignatures(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	newKey := func(name string) string {
+		key := filepath.Join(tempDir, name)
+		if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", name, "-f", key).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen failed: %v\n%s", err, output)
+		}
+		return key
+	}
+	trusted, untrusted := newKey("trusted"), newKey("untrusted")
+	publicKey, err := os.ReadFile(trusted + ".pub")
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	writeFiles(t, tempDir, map[string]string{"allowed_signers": "test@example.com namespaces=\"git\" " + string(publicKey)})
+
+	bare, work := createRepo(t, tempDir, map[string]string{"protos/service.proto": "syntax = \"proto3\";\n"})
+	signedCommit := func(key, content string) {
+		writeFiles(t, work, map[string]string{"protos/service.proto": content})
+		runGit(t, work, "add", "-A")
+		runGit(t, work, "-c", "gpg.format=ssh", "-c", "user.signingkey="+key, "commit", "-S", "-m", "signed")
+		runGit(t, work, "push", bare, "HEAD:main")
+	}
+	config := &Config{
+		GitHubURL:        "file://" + bare,
+		Branch:           "main",
+		RemotePath:       "protos",
+		ProtoDir:         "./proto",
+		VerifySignatures: true,
+		AllowedSigners:   "allowed_signers",
+		path:             filepath.Join(tempDir, ConfigFileName),
+	}
+	var sigErr *SignatureError
+
+	// The initial commit is unsigned
+	if _, err := Sync(config, SyncOptions{}); !errors.As(err, &sigErr) {
+		t.Fatalf("Sync() of unsigned commit error = %v, want a SignatureError", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "proto")); !os.IsNotExist(err) {
+		t.Error("Sync() of unsigned commit created the proto directory")
+	}
+
+	signedCommit(trusted, "syntax = \"proto3\";\npackage trusted;\n")
+	if _, err := Sync(config, SyncOptions{}); err != nil {
+		t.Fatalf("Sync() of signed commit error = %v", err)
+	}
+
+	signedCommit(untrusted, "syntax = \"proto3\";\npackage untrusted;\n")
+	if _, err := Sync(config, SyncOptions{}); !errors.As(err, &sigErr) {
+		t.Errorf("Sync() of commit by unknown key error = %v, want a SignatureError", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tempDir, "proto", "service.proto")); !strings.Contains(string(data), "package trusted") {
+		t.Errorf("rejected commit was synced: %s", data)
+	}
+
+	config.AllowedSigners = "missing_signers"
+	if _, err := Sync(config, SyncOptions{}); err == nil || !strings.Contains(err.Error(), "allowed_signers") {
+		t.Errorf("Sync() with missing allowed_signers error = %v, want an error naming it", err)
+	}
+}
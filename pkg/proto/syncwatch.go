@@ -0,0 +1,163 @@
+package proto
+
+import (
+	"context"
+	"time"
+)
+
+// SyncWatchOptions holds the settings for WatchSync
+type SyncWatchOptions struct {
+	// Interval is how long to wait between polls
+	Interval time.Duration
+	// MaxBackoff caps the wait after failed polls, which doubles with each
+	// consecutive failure. It defaults to an hour, or Interval if longer.
+	MaxBackoff time.Duration
+	// Force is passed on to each sync
+	Force bool
+	// AfterSync runs after each sync that changed files, such as to
+	// generate code. Its error fails the cycle.
+	AfterSync func(*SyncResult) error
+	// Log receives an event at the end of every cycle
+	Log func(SyncEvent)
+}
+
+// SyncEvent describes one polling cycle of WatchSync
+type SyncEvent struct {
+	Cycle int
+	// Status is "synced" when files changed, "up_to_date" when nothing
+	// needed syncing or the sync changed no files, and "error"
+	Status string
+	// Heads maps each repository source to the commit its branch points at
+	// upstream. The main source is "main", dependencies go by their name.
+	Heads map[string]string
+	// Changed lists the sources whose files were synced
+	Changed []string
+	// Generated is set when AfterSync ran successfully
+	Generated bool
+	Err       error
+	// Failures counts consecutive failed cycles, including this one
+	Failures int
+	// NextPoll is how long until the next cycle
+	NextPoll time.Duration
+	Duration time.Duration
+}
+
+// watchedSource is a source WatchSync polls
+type watchedSource struct {
+	name   string
+	source Source
+	dir    string
+}
+
+// WatchSync polls the configured sources every opts.Interval and syncs when
+// one has changed: repositories are asked for their head with git ls-remote,
+// local directories are hashed. It returns nil once ctx is done; a cycle
+// already running is finished first.
+func WatchSync(ctx context.Context, config *Config, opts SyncWatchOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Minute
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.MaxBackoff < opts.Interval {
+		opts.MaxBackoff = opts.Interval
+	}
+
+	sources := []watchedSource{{name: "main", source: config.Source(), dir: config.ProtoPath()}}
+	for _, dep := range config.Deps {
+		sources = append(sources, watchedSource{name: dep.Name, source: dep.Source, dir: config.DepPath(dep.Name)})
+	}
+
+	failures := 0
+	for cycle := 1; ; cycle++ {
+		start := time.Now()
+		event := pollCycle(config, sources, opts)
+		event.Cycle = cycle
+		event.Duration = time.Since(start)
+
+		if event.Err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+		event.Failures = failures
+		event.NextPoll = opts.Interval
+		for i := 0; i < failures && event.NextPoll < opts.MaxBackoff; i++ {
+			event.NextPoll *= 2
+		}
+		if event.NextPoll > opts.MaxBackoff {
+			event.NextPoll = opts.MaxBackoff
+		}
+		if opts.Log != nil {
+			opts.Log(event)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(event.NextPoll):
+		}
+	}
+}
+
+// pollCycle checks every source and syncs if any changed
+func pollCycle(config *Config, sources []watchedSource, opts SyncWatchOptions) SyncEvent {
+	event := SyncEvent{Status: "up_to_date", Heads: map[string]string{}}
+
+	outdated := false
+	for _, watched := range sources {
+		switch watched.source.Kind() {
+		case "git":
+			head, err := remoteHead(watched.source.Auth, watched.source)
+			if err != nil {
+				event.Status, event.Err = "error", err
+				return event
+			}
+			event.Heads[watched.name] = head
+			// An unreadable state only costs a sync
+			state, _ := readSyncState(watched.dir)
+			outdated = outdated || head != state.GitHead
+		default:
+			status, err := sourceStatus(config, watched.source, watched.dir, StatusOptions{}, nil)
+			if err == nil {
+				err = status.Err
+			}
+			if err != nil {
+				event.Status, event.Err = "error", err
+				return event
+			}
+			outdated = outdated || status.Outdated()
+		}
+	}
+	if !outdated {
+		return event
+	}
+
+	result, err := Sync(config, SyncOptions{Force: opts.Force})
+	if err != nil {
+		event.Status, event.Err = "error", err
+		return event
+	}
+	if !result.UpToDate {
+		event.Changed = append(event.Changed, "main")
+	}
+	for _, dep := range result.Deps {
+		if !dep.UpToDate {
+			event.Changed = append(event.Changed, dep.Name)
+		}
+	}
+	if len(event.Changed) == 0 {
+		return event
+	}
+
+	event.Status = "synced"
+	if opts.AfterSync != nil {
+		if err := opts.AfterSync(result); err != nil {
+			event.Status, event.Err = "error", err
+			return event
+		}
+		event.Generated = true
+	}
+	return event
+}
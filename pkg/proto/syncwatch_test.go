@@ -0,0 +1,141 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchSync(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	originalCache := os.Getenv("PROTO_CACHE_DIR")
+	os.Setenv("PROTO_CACHE_DIR", filepath.Join(tempDir, "cache"))
+	defer os.Setenv("PROTO_CACHE_DIR", originalCache)
+
+	bare, work := createRepo(t, tempDir, map[string]string{
+		"protos/api/service.proto": "syntax = \"proto3\";\n",
+	})
+	config := &Config{
+		GitHubURL:  "file://" + bare,
+		Branch:     "main",
+		RemotePath: "protos",
+		ProtoDir:   "./proto",
+		path:       filepath.Join(tempDir, ConfigFileName),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan SyncEvent, 100)
+	generated := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchSync(ctx, config, SyncWatchOptions{
+			Interval: 20 * time.Millisecond,
+			AfterSync: func(*SyncResult) error {
+				generated++
+				if generated == 2 {
+					return errors.New("generation failed")
+				}
+				return nil
+			},
+			Log: func(event SyncEvent) { events <- event },
+		})
+	}()
+	next := func() SyncEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for a sync event")
+			return SyncEvent{}
+		}
+	}
+
+	event := next()
+	head := runGit(t, work, "rev-parse", "HEAD")
+	if event.Cycle != 1 || event.Status != "synced" || event.Heads["main"] != head || !reflect.DeepEqual(event.Changed, []string{"main"}) || !event.Generated {
+		t.Errorf("First event = %+v, want a sync of %s followed by generation", event, head)
+	}
+	if event = next(); event.Status != "up_to_date" || event.Changed != nil {
+		t.Errorf("Second event = %+v, want up_to_date", event)
+	}
+
+	// A commit that does not change the synced files is not synced again
+	// on every poll
+	commitFiles(t, work, bare, "Add README", map[string]string{"README.md": "docs\n"})
+	for i := 0; i < 3; i++ {
+		if event = next(); event.Status != "up_to_date" {
+			t.Errorf("Event after an unrelated commit = %+v, want up_to_date", event)
+		}
+	}
+
+	// A failed generation fails the cycle and backs off
+	commitFiles(t, work, bare, "Add user", map[string]string{"protos/api/user.proto": "syntax = \"proto3\";\n"})
+	for event = next(); event.Status == "up_to_date"; event = next() {
+	}
+	if event.Status != "error" || event.Err == nil || event.Failures != 1 || event.NextPoll != 40*time.Millisecond {
+		t.Errorf("Event after a failed generation = %+v, want an error backing off to 40ms", event)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "proto", "api", "user.proto")); err != nil {
+		t.Errorf("user.proto was not synced: %v", err)
+	}
+	if event = next(); event.Status != "up_to_date" || event.Failures != 0 || event.NextPoll != 20*time.Millisecond {
+		t.Errorf("Event after recovering = %+v, want up_to_date at the normal interval", event)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WatchSync() error = %v, want nil after cancellation", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WatchSync() did not stop after cancellation")
+	}
+}
+
+func TestWatchSyncBackoff(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &Config{
+		GitHubURL: "file://" + filepath.Join(tempDir, "missing.git"),
+		ProtoDir:  filepath.Join(tempDir, "proto"),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var polls []time.Duration
+	err = WatchSync(ctx, config, SyncWatchOptions{
+		Interval:   10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		Log: func(event SyncEvent) {
+			if event.Status != "error" {
+				t.Errorf("Event = %+v, want an error", event)
+			}
+			polls = append(polls, event.NextPoll)
+			if len(polls) == 4 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("WatchSync() error = %v", err)
+	}
+	want := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+	if !reflect.DeepEqual(polls, want) {
+		t.Errorf("Waits between polls = %v, want %v", polls, want)
+	}
+}
@@ -0,0 +1,261 @@
+package proto
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Toolchain pins the versions of protoc and its plugins used for generation
+type Toolchain struct {
+	Protoc  string            `yaml:"protoc,omitempty"`
+	Plugins map[string]string `yaml:"plugins,omitempty"`
+	Mirror  string            `yaml:"mirror,omitempty"`
+}
+
+// Constraint returns the version constraint configured for a tool
+func (t Toolchain) Constraint(tool string) string {
+	if tool == "protoc" {
+		return t.Protoc
+	}
+	return t.Plugins[tool]
+}
+
+// Pinned returns the names of all tools that have a version constraint
+func (t Toolchain) Pinned() []string {
+	var tools []string
+	if t.Protoc != "" {
+		tools = append(tools, "protoc")
+	}
+	for name, constraint := range t.Plugins {
+		if constraint != "" {
+			tools = append(tools, name)
+		}
+	}
+	sort.Strings(tools)
+	return tools
+}
+
+// TargetTools lists the tools each generation target invokes. For Python
+// these are the tools of PythonModeProtoc; CheckPythonToolchain checks the
+// ones of the mode actually used.
+var TargetTools = map[string][]string{
+	"go":     {"protoc", "protoc-gen-go", "protoc-gen-go-grpc"},
+	"python": {"protoc", "protoc-gen-grpc_python", "protoc-gen-mypy"},
+}
+
+// ToolStatus describes the resolved version of a single tool
+type ToolStatus struct {
+	Name       string
+	Path       string
+	Version    string
+	Constraint string
+	Err        error
+}
+
+// OK reports whether the tool satisfies its constraint
+func (s ToolStatus) OK() bool {
+	return s.Err == nil
+}
+
+// Version is a parsed tool version. Parts records how many components were
+// given, so that "25" and "25.0.0" can be told apart when matching.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	Parts int
+}
+
+func (v Version) String() string {
+	switch v.Parts {
+	case 1:
+		return strconv.Itoa(v.Major)
+	case 2:
+		return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	default:
+		return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	}
+}
+
+// Compare returns -1, 0 or 1 comparing v to o on all three components
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+var versionPattern = regexp.MustCompile(`v?(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+// ParseVersion extracts the first version number found in s, so it accepts
+// both bare versions and tool output like "libprotoc 25.1"
+func ParseVersion(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("no version found in %q", strings.TrimSpace(s))
+	}
+	var v Version
+	for i, dst := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if m[i+1] == "" {
+			break
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q: %v", s, err)
+		}
+		*dst = n
+		v.Parts = i + 1
+	}
+	return v, nil
+}
+
+// MatchConstraint reports whether version satisfies constraint. A constraint
+// is a list of comparisons separated by spaces or commas, all of which must
+// hold. Supported operators are =, >, >=, <, <=, ~ (same minor) and ^ (same
+// major). A bare version matches every version sharing its given components,
+// so "1.34" matches "1.34.2".
+func MatchConstraint(constraint, version string) (bool, error) {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	terms := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(terms) == 0 {
+		return true, nil
+	}
+	for _, term := range terms {
+		ok, err := matchTerm(term, v)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func matchTerm(term string, v Version) (bool, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+	raw := strings.TrimPrefix(term, op)
+	raw = strings.TrimSuffix(strings.TrimSuffix(raw, ".x"), ".*")
+	want, err := ParseVersion(raw)
+	if err != nil || versionPattern.FindString(raw) != raw {
+		return false, fmt.Errorf("invalid version constraint %q", term)
+	}
+
+	switch op {
+	case ">=":
+		return v.Compare(want) >= 0, nil
+	case "<=":
+		return v.Compare(want) <= 0, nil
+	case ">":
+		return v.Compare(want) > 0, nil
+	case "<":
+		return v.Compare(want) < 0, nil
+	case "~":
+		upper := Version{Major: want.Major, Minor: want.Minor + 1}
+		if want.Parts == 1 {
+			upper = Version{Major: want.Major + 1}
+		}
+		return v.Compare(want) >= 0 && v.Compare(upper) < 0, nil
+	case "^":
+		upper := Version{Major: want.Major + 1}
+		if want.Major == 0 && want.Parts > 1 {
+			upper = Version{Minor: want.Minor + 1}
+		}
+		return v.Compare(want) >= 0 && v.Compare(upper) < 0, nil
+	default:
+		got := []int{v.Major, v.Minor, v.Patch}
+		exp := []int{want.Major, want.Minor, want.Patch}
+		for i := 0; i < want.Parts; i++ {
+			if got[i] != exp[i] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+// ToolVersion runs "<path> --version" and returns the version it reports
+func ToolVersion(path string) (string, error) {
+	return commandVersion(path)
+}
+
+// commandVersion runs a command with --version appended and returns the
+// version it reports
+func commandVersion(name string, args ...string) (string, error) {
+	args = append(args, "--version")
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error running %s: %v", strings.Join(append([]string{name}, args...), " "), err)
+	}
+	v, err := ParseVersion(string(output))
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// CheckToolchain resolves the version of every tool in tools and checks it
+// against the constraint pinned in the toolchain. lookPath locates each tool
+// and is usually exec.LookPath.
+func CheckToolchain(toolchain Toolchain, tools []string, lookPath func(string) (string, error)) []ToolStatus {
+	return checkTools(toolchain, tools, lookPath, ToolVersion)
+}
+
+// checkTools is CheckToolchain with version resolving the version of the
+// tool found at a path
+func checkTools(toolchain Toolchain, tools []string, lookPath func(string) (string, error), version func(string) (string, error)) []ToolStatus {
+	var statuses []ToolStatus
+	for _, tool := range tools {
+		status := ToolStatus{Name: tool, Constraint: toolchain.Constraint(tool)}
+		path, err := lookPath(tool)
+		if err != nil {
+			if status.Constraint != "" {
+				status.Err = fmt.Errorf("%s not found", tool)
+			}
+			statuses = append(statuses, status)
+			continue
+		}
+		status.Path = path
+
+		version, err := version(path)
+		if err != nil {
+			if status.Constraint != "" {
+				status.Err = fmt.Errorf("could not determine %s version: %v", tool, err)
+			}
+			statuses = append(statuses, status)
+			continue
+		}
+		status.Version = version
+
+		if status.Constraint != "" {
+			ok, err := MatchConstraint(status.Constraint, version)
+			if err != nil {
+				status.Err = err
+			} else if !ok {
+				status.Err = fmt.Errorf("%s %s does not satisfy %q", tool, version, status.Constraint)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
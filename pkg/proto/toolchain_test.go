@@ -0,0 +1,162 @@
+package proto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "libprotoc 25.1", want: "25.1"},
+		{input: "libprotoc 3.21.12", want: "3.21.12"},
+		{input: "protoc-gen-go v1.34.2", want: "1.34.2"},
+		{input: "protoc-gen-go-grpc 1.5.1\n", want: "1.5.1"},
+		{input: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+		wantErr    bool
+	}{
+		{constraint: "", version: "1.0.0", want: true},
+		{constraint: "25.1", version: "25.1", want: true},
+		{constraint: "25.1", version: "25.2", want: false},
+		{constraint: "1.34", version: "1.34.2", want: true},
+		{constraint: "1.34.x", version: "1.34.2", want: true},
+		{constraint: "=1.34.1", version: "1.34.2", want: false},
+		{constraint: ">=25.0 <26", version: "25.3", want: true},
+		{constraint: ">=25.0, <26", version: "26.0", want: false},
+		{constraint: ">3.20", version: "3.21.12", want: true},
+		{constraint: "<=3.20", version: "3.21.12", want: false},
+		{constraint: "~1.3", version: "1.3.9", want: true},
+		{constraint: "~1.3", version: "1.4.0", want: false},
+		{constraint: "^1.3", version: "1.9.0", want: true},
+		{constraint: "^1.3", version: "2.0.0", want: false},
+		{constraint: "^0.3", version: "0.4.0", want: false},
+		{constraint: ">=abc", version: "1.0.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.constraint, tt.version), func(t *testing.T) {
+			got, err := MatchConstraint(tt.constraint, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchConstraint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("MatchConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckToolchain(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Fake tools that only answer --version
+	tools := map[string]string{
+		"protoc":        "libprotoc 25.1",
+		"protoc-gen-go": "protoc-gen-go v1.34.2",
+	}
+	for name, output := range tools {
+		script := fmt.Sprintf("#!/bin/sh\necho '%s'\n", output)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write fake tool: %v", err)
+		}
+	}
+	lookPath := func(name string) (string, error) {
+		path := filepath.Join(tempDir, name)
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	toolchain := Toolchain{
+		Protoc: ">=25 <26",
+		Plugins: map[string]string{
+			"protoc-gen-go":      "1.33",
+			"protoc-gen-go-grpc": "1.5",
+		},
+	}
+	statuses := CheckToolchain(toolchain, []string{"protoc", "protoc-gen-go", "protoc-gen-go-grpc", "protoc-gen-mypy"}, lookPath)
+
+	want := map[string]struct {
+		version string
+		ok      bool
+	}{
+		"protoc":             {version: "25.1", ok: true},
+		"protoc-gen-go":      {version: "1.34.2", ok: false},
+		"protoc-gen-go-grpc": {version: "", ok: false},
+		"protoc-gen-mypy":    {version: "", ok: true},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("CheckToolchain() returned %d statuses, want %d", len(statuses), len(want))
+	}
+	for _, status := range statuses {
+		w := want[status.Name]
+		if status.Version != w.version {
+			t.Errorf("%s version = %q, want %q", status.Name, status.Version, w.version)
+		}
+		if status.OK() != w.ok {
+			t.Errorf("%s OK() = %v, want %v (err: %v)", status.Name, status.OK(), w.ok, status.Err)
+		}
+	}
+}
+
+func TestGenManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifest, err := LoadGenManifest(tempDir)
+	if err != nil {
+		t.Fatalf("LoadGenManifest() error = %v", err)
+	}
+	manifest.RecordToolchain("go", []ToolStatus{
+		{Name: "protoc", Path: "/usr/bin/protoc", Version: "25.1"},
+		{Name: "protoc-gen-go-grpc"},
+	})
+	if err := SaveGenManifest(tempDir, manifest); err != nil {
+		t.Fatalf("SaveGenManifest() error = %v", err)
+	}
+
+	got, err := LoadGenManifest(tempDir)
+	if err != nil {
+		t.Fatalf("LoadGenManifest() error = %v", err)
+	}
+	toolchain := got.Targets["go"].Toolchain
+	if toolchain["protoc"] != "25.1" {
+		t.Errorf("protoc = %q, want %q", toolchain["protoc"], "25.1")
+	}
+	if toolchain["protoc-gen-go-grpc"] != "not installed" {
+		t.Errorf("protoc-gen-go-grpc = %q, want %q", toolchain["protoc-gen-go-grpc"], "not installed")
+	}
+}
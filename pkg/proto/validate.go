@@ -0,0 +1,255 @@
+package proto
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the JSON Schema describing .protorc
+//
+//go:embed protorc.schema.json
+var Schema []byte
+
+// parseConfig strictly decodes a config file, rejecting unknown keys
+func parseConfig(data []byte, configPath string) (*Config, error) {
+	// Upgrade older formats in memory before decoding strictly, since they
+	// may contain keys the current Config no longer has
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", configPath, err)
+	}
+	var state migrationState
+	var applied []string
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		var err error
+		if applied, err = migrateNode(doc.Content[0], &state); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", configPath, err)
+		}
+	}
+
+	var config Config
+	if len(doc.Content) > 0 {
+		if problems := unknownKeys(doc.Content[0], reflect.TypeOf(config)); len(problems) > 0 {
+			return nil, fmt.Errorf("error parsing config file %s: %s", configPath, strings.Join(problems, "; "))
+		}
+		if err := doc.Content[0].Decode(&config); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", configPath, err)
+		}
+	}
+	config.path = configPath
+	config.migrations = applied
+	config.legacyGitHead = state.gitHead
+
+	// Only keys written in the file come from it; the rest keep their
+	// defaults, which for booleans cannot be told apart by value
+	config.origins = map[string]string{}
+	for _, setting := range Settings {
+		if len(doc.Content) > 0 && hasKey(doc.Content[0], setting.Key) {
+			config.origins[setting.Key] = configPath
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", configPath, err)
+	}
+	return &config, nil
+}
+
+// hasKey reports whether the dotted key path is set in a YAML mapping
+func hasKey(node *yaml.Node, key string) bool {
+	name, rest, nested := strings.Cut(key, ".")
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != name {
+			continue
+		}
+		if !nested {
+			return node.Content[i+1].Tag != "!!null"
+		}
+		return hasKey(node.Content[i+1], rest)
+	}
+	return false
+}
+
+// yamlFields maps the YAML keys of a struct type to their field types,
+// flattening inline structs into their parent
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for inlineName, inlineType := range yamlFields(field.Type) {
+				fields[inlineName] = inlineType
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// unknownKeys walks a YAML tree alongside the Go type it decodes into and
+// reports every key the type does not have, with its line number and the
+// closest valid key. Checking the tree rather than the raw bytes keeps line
+// numbers accurate after in-memory migrations.
+func unknownKeys(node *yaml.Node, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var problems []string
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				problem := fmt.Sprintf("line %d: unknown key %q", key.Line, key.Value)
+				if suggestion := closestKey(key.Value, names); suggestion != "" {
+					problem += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				problems = append(problems, problem)
+				continue
+			}
+			problems = append(problems, unknownKeys(node.Content[i+1], fieldType)...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			problems = append(problems, unknownKeys(item, t.Elem())...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			problems = append(problems, unknownKeys(node.Content[i], t.Elem())...)
+		}
+	}
+	return problems
+}
+
+// closestKey returns the candidate nearest to key by edit distance, or "" if
+// none is close enough to be a plausible typo
+func closestKey(key string, candidates []string) string {
+	best, bestDistance := "", len(key)/2+2
+	for _, candidate := range candidates {
+		if d := editDistance(key, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+// sha256Pattern matches a hex sha256 digest
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// validateSignatures reports signature settings that cannot take effect.
+// label prefixes the problems, and is empty for the main source.
+func validateSignatures(label string, source Source) []string {
+	var problems []string
+	if source.VerifySignatures && source.Kind() != "git" {
+		problems = append(problems, label+"verify_signatures only applies to github_url sources, which have commits to verify")
+	}
+	if source.AllowedSigners != "" && !source.VerifySignatures {
+		problems = append(problems, label+"allowed_signers has no effect without verify_signatures: true")
+	}
+	return problems
+}
+
+// validateAuth reports credentials settings that cannot work. label prefixes
+// the problems, and is empty for the main source.
+func validateAuth(label string, auth Auth) []string {
+	switch auth.TokenMethod {
+	case "", "helper", "header":
+		return nil
+	}
+	return []string{fmt.Sprintf("%sauth.token_method must be helper or header, not %q", label, auth.TokenMethod)}
+}
+
+// Validate checks the config for values the YAML decoder accepts but that
+// cannot work, such as malformed version constraints
+func (c *Config) Validate() error {
+	var problems []string
+	sources := 0
+	for _, set := range []bool{c.GitHubURL != "", c.LocalPath != "", c.Archive.URL != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		problems = append(problems, "github_url, path and archive.url are mutually exclusive, set only one source")
+	}
+	if c.Archive.URL != "" && !sha256Pattern.MatchString(c.Archive.SHA256) {
+		problems = append(problems, "archive.sha256 must be the 64 hex digit sha256 of the archive")
+	}
+	if hasEmbeddedPassword(c.GitHubURL) {
+		problems = append(problems, "github_url must not contain credentials, use auth.token_env or auth.netrc instead")
+	}
+	problems = append(problems, validateAuth("", c.Auth)...)
+	for _, list := range []struct {
+		key      string
+		patterns []string
+	}{{"include", c.Include}, {"exclude", c.Exclude}} {
+		for _, pattern := range list.patterns {
+			if err := ValidateGlob(pattern); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", list.key, err))
+			}
+		}
+	}
+	switch c.Changelog {
+	case "", "print", "file", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("changelog must be print, file or none, not %q", c.Changelog))
+	}
+	problems = append(problems, validateSignatures("", c.Source())...)
+	problems = append(problems, c.validateDeps()...)
+	problems = append(problems, c.Python.validate()...)
+	problems = append(problems, c.Hooks.validate()...)
+	for _, tool := range c.Toolchain.Pinned() {
+		if _, err := MatchConstraint(c.Toolchain.Constraint(tool), "0"); err != nil {
+			problems = append(problems, fmt.Sprintf("toolchain %s: %v", tool, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package proto
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigStrict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr []string
+	}{
+		{
+			name:    "valid",
+			content: "github_url: https://github.com/example/repo\ntoolchain:\n  protoc: \">=25\"\n",
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name:    "typo at top level",
+			content: "github_url: https://github.com/example/repo\nremote_pth: api\n",
+			wantErr: []string{"line 2", `unknown key "remote_pth"`, `did you mean "remote_path"`},
+		},
+		{
+			name:    "typo in toolchain",
+			content: "toolchain:\n  protc: \"25.1\"\n",
+			wantErr: []string{"line 2", `unknown key "protc"`, `did you mean "protoc"`},
+		},
+		{
+			name:    "unrelated key",
+			content: "completely_unrelated: true\n",
+			wantErr: []string{`unknown key "completely_unrelated"`},
+		},
+		{
+			name:    "signatures on a local path",
+			content: "path: ./protos\nverify_signatures: true\n",
+			wantErr: []string{"verify_signatures only applies to github_url"},
+		},
+		{
+			name:    "allowed signers without verification",
+			content: "github_url: https://github.com/example/repo\nallowed_signers: ./allowed_signers\n",
+			wantErr: []string{"allowed_signers has no effect"},
+		},
+		{
+			name:    "bad constraint",
+			content: "toolchain:\n  protoc: \">=abc\"\n",
+			wantErr: []string{"toolchain protoc"},
+		},
+		{
+			name:    "empty hook",
+			content: "github_url: https://github.com/example/repo\nhooks:\n  go:\n    post_gen: [\"goimports -w .\", \"\"]\n",
+			wantErr: []string{"hooks.go.post_gen must not contain empty commands"},
+		},
+		{
+			name:    "unknown hook target",
+			content: "github_url: https://github.com/example/repo\nhooks:\n  rust:\n    post_gen: [cargo fmt]\n",
+			wantErr: []string{"rust"},
+		},
+		{
+			name:    "dependency token method",
+			content: "github_url: https://github.com/example/repo\ndeps:\n  - name: shared\n    github_url: https://github.com/example/shared\n    auth:\n      token_method: cookie\n",
+			wantErr: []string{"dependency shared: auth.token_method must be helper or header"},
+		},
+		{
+			name:    "invalid python package",
+			content: "github_url: https://github.com/example/repo\npython:\n  package: our-api\n",
+			wantErr: []string{"python.package must be a dotted Python package name"},
+		},
+		{
+			name:    "pyproject without package",
+			content: "github_url: https://github.com/example/repo\npython:\n  pyproject: true\n",
+			wantErr: []string{"python.pyproject requires python.package"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, ".protorc")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write .protorc: %v", err)
+			}
+			_, err := ReadConfig(configPath)
+			if (err != nil) != (len(tt.wantErr) > 0) {
+				t.Fatalf("ReadConfig() error = %v, want error containing %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("ReadConfig() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if tt.name == "unrelated key" && strings.Contains(err.Error(), "did you mean") {
+				t.Errorf("ReadConfig() error = %v, want no suggestion", err)
+			}
+		})
+	}
+}
+
+func TestSetAndUnsetConfigValue(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, ".protorc")
+	original := "# shared settings\ngithub_url: https://github.com/example/repo # upstream\nbranch: main\n"
+	if err := os.WriteFile(configPath, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write .protorc: %v", err)
+	}
+
+	if err := SetConfigValue(configPath, "branch", "develop"); err != nil {
+		t.Fatalf("SetConfigValue() error = %v", err)
+	}
+	if err := SetConfigValue(configPath, "toolchain.plugins.protoc-gen-go", "1.34"); err != nil {
+		t.Fatalf("SetConfigValue() error = %v", err)
+	}
+	if err := SetConfigValue(configPath, "toolchain.protoc", ">=abc"); err == nil {
+		t.Error("SetConfigValue() error = nil, want error for invalid constraint")
+	}
+	if err := SetConfigValue(configPath, "remote_pth", "api"); err == nil || !strings.Contains(err.Error(), "remote_path") {
+		t.Errorf("SetConfigValue() error = %v, want suggestion for remote_path", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read .protorc: %v", err)
+	}
+	for _, want := range []string{"# shared settings", "# upstream", "branch: develop"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf(".protorc = %q, want it to contain %q", data, want)
+		}
+	}
+
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	if config.Toolchain.Constraint("protoc-gen-go") != "1.34" {
+		t.Errorf("Constraint(protoc-gen-go) = %q, want %q", config.Toolchain.Constraint("protoc-gen-go"), "1.34")
+	}
+	if value, ok, err := GetConfigValue(configPath, "toolchain.plugins.protoc-gen-go"); err != nil || !ok || value != "1.34" {
+		t.Errorf("GetConfigValue() = %q, %v, %v, want 1.34", value, ok, err)
+	}
+
+	if err := UnsetConfigValue(configPath, "toolchain.plugins.protoc-gen-go"); err != nil {
+		t.Fatalf("UnsetConfigValue() error = %v", err)
+	}
+	if _, ok, _ := GetConfigValue(configPath, "toolchain"); ok {
+		t.Error("UnsetConfigValue() left an empty toolchain mapping behind")
+	}
+	if err := UnsetConfigValue(configPath, "toolchain.protoc"); err == nil {
+		t.Error("UnsetConfigValue() error = nil, want error for missing key")
+	}
+}
+
+// schemaProperties collects the property names of a JSON Schema object
+func schemaProperties(t *testing.T, schema map[string]interface{}) map[string]map[string]interface{} {
+	t.Helper()
+	properties := map[string]map[string]interface{}{}
+	raw, _ := schema["properties"].(map[string]interface{})
+	for name, value := range raw {
+		properties[name], _ = value.(map[string]interface{})
+	}
+	return properties
+}
+
+func TestSchemaMatchesConfig(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+
+	var compare func(path string, typ reflect.Type, schema map[string]interface{})
+	var compareFields func(path string, typ reflect.Type, schema map[string]interface{})
+	compare = func(path string, typ reflect.Type, schema map[string]interface{}) {
+		var schemaKeys []string
+		for name := range schemaProperties(t, schema) {
+			schemaKeys = append(schemaKeys, name)
+		}
+		var structKeys []string
+		for name := range yamlFields(typ) {
+			structKeys = append(structKeys, name)
+		}
+		sort.Strings(schemaKeys)
+		sort.Strings(structKeys)
+		if !reflect.DeepEqual(schemaKeys, structKeys) {
+			t.Errorf("%s: schema properties = %v, struct keys = %v", path, schemaKeys, structKeys)
+		}
+		if schema["additionalProperties"] != false {
+			t.Errorf("%s: schema must set additionalProperties to false", path)
+		}
+		compareFields(path, typ, schema)
+	}
+	// compareFields descends into struct-typed fields, treating inline
+	// structs as part of the enclosing object
+	compareFields = func(path string, typ reflect.Type, schema map[string]interface{}) {
+		properties := schemaProperties(t, schema)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Slice {
+				fieldType = fieldType.Elem()
+			}
+			if !field.IsExported() || fieldType.Kind() != reflect.Struct {
+				continue
+			}
+			if strings.Contains(opts, "inline") {
+				compareFields(path, fieldType, schema)
+				continue
+			}
+			child := properties[name]
+			if items, ok := child["items"].(map[string]interface{}); ok {
+				child = items
+			}
+			compare(path+"."+name, fieldType, child)
+		}
+	}
+	compare("config", reflect.TypeOf(Config{}), schema)
+}
@@ -0,0 +1,357 @@
+package proto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchOptions holds the optional settings for a Watcher
+type WatchOptions struct {
+	// Debounce is how long changes must settle before they are reported
+	Debounce time.Duration
+	// Interval is how often directories are scanned when polling
+	Interval time.Duration
+	// Poll scans the directories every Interval instead of relying on
+	// filesystem notifications, which some network and container file
+	// systems do not deliver
+	Poll bool
+}
+
+// Watcher reports changes to the .proto files under a set of directories. It
+// relies on filesystem notifications where available and falls back to
+// polling otherwise. Changes are detected by content, so files rewritten
+// with the same content, or created and removed again between two reports,
+// are not reported.
+type Watcher struct {
+	dirs   []string
+	opts   WatchOptions
+	notify *fsnotify.Watcher
+	// files maps each .proto file to its sha256 as of the last report
+	files map[string]string
+}
+
+// NewWatcher starts watching dirs. Directories that do not exist yet are
+// picked up once they are created, when polling or when their parent is
+// watched.
+func NewWatcher(dirs []string, opts WatchOptions) (*Watcher, error) {
+	if opts.Debounce <= 0 {
+		opts.Debounce = 200 * time.Millisecond
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	w := &Watcher{opts: opts}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		w.dirs = append(w.dirs, abs)
+	}
+	if !opts.Poll {
+		if notify, err := fsnotify.NewWatcher(); err == nil {
+			w.notify = notify
+		}
+	}
+
+	files, err := w.scan()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	w.files = files
+	return w, nil
+}
+
+// Polling reports whether the watcher scans the directories periodically
+// instead of receiving notifications
+func (w *Watcher) Polling() bool {
+	return w.notify == nil
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	if w.notify != nil {
+		return w.notify.Close()
+	}
+	return nil
+}
+
+// Next blocks until .proto files change and have stayed unchanged for the
+// debounce period, and returns the absolute paths of the files added,
+// modified or removed since the previous call, sorted. It returns ctx's error
+// once ctx is done.
+func (w *Watcher) Next(ctx context.Context) ([]string, error) {
+	for {
+		if err := w.wait(ctx); err != nil {
+			return nil, err
+		}
+		if err := w.settle(ctx); err != nil {
+			return nil, err
+		}
+		files, err := w.scan()
+		if err != nil {
+			return nil, err
+		}
+		changed := diffDigests(w.files, files)
+		w.files = files
+		if len(changed) > 0 {
+			return changed, nil
+		}
+	}
+}
+
+// wait blocks until something may have changed
+func (w *Watcher) wait(ctx context.Context) error {
+	if w.notify == nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.opts.Interval):
+			return nil
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case _, ok := <-w.notify.Events:
+		if !ok {
+			w.notify = nil
+		}
+		return nil
+	case _, ok := <-w.notify.Errors:
+		// Events may have been lost, such as on an inotify queue overflow,
+		// so fall back to polling rather than miss changes
+		if ok {
+			w.notify.Close()
+		}
+		w.notify = nil
+		return nil
+	}
+}
+
+// settle waits until no event has arrived for the debounce period, or when
+// polling, until two scans a debounce period apart agree
+func (w *Watcher) settle(ctx context.Context) error {
+	if w.notify == nil {
+		previous, err := w.scan()
+		if err != nil {
+			return err
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(w.opts.Debounce):
+			}
+			current, err := w.scan()
+			if err != nil {
+				return err
+			}
+			if len(diffDigests(previous, current)) == 0 {
+				return nil
+			}
+			previous = current
+		}
+	}
+
+	timer := time.NewTimer(w.opts.Debounce)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-w.notify.Events:
+			if !ok {
+				w.notify = nil
+				return nil
+			}
+			timer.Reset(w.opts.Debounce)
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// scan digests every .proto file under the watched directories and, when
+// using notifications, watches every directory found so new subdirectories
+// are covered
+func (w *Watcher) scan() (map[string]string, error) {
+	files := map[string]string{}
+	for _, dir := range w.dirs {
+		if w.notify != nil {
+			// A missing directory is watched through its parent, so it is
+			// noticed once created
+			w.watch(filepath.Dir(dir))
+		}
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				if w.notify != nil {
+					w.watch(path)
+				}
+				return nil
+			}
+			if !strings.HasSuffix(info.Name(), ".proto") {
+				return nil
+			}
+			digests, err := digestFiles(filepath.Dir(path), []string{info.Name()})
+			if err != nil {
+				// Removed between listing and reading
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			files[path] = digests[info.Name()]
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// watch adds a notification watch on dir, switching to polling if that fails,
+// for example because the system's watch limit was reached
+func (w *Watcher) watch(dir string) {
+	if err := w.notify.Add(dir); err != nil && !os.IsNotExist(err) {
+		w.notify.Close()
+		w.notify = nil
+	}
+}
+
+// diffDigests returns the files whose digest differs between old and new,
+// including files present in only one of them, sorted
+func diffDigests(old, new map[string]string) []string {
+	var changed []string
+	for _, file := range unionKeys(old, new) {
+		if old[file] != new[file] {
+			changed = append(changed, file)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// WatchDirs returns the directories whose changes affect generation:
+// ProtoDir, each dependency's vendor directory, and every local directory
+// source
+func WatchDirs(config *Config) []string {
+	var dirs []string
+	for _, synced := range syncedDirs(config) {
+		dirs = append(dirs, synced.dir)
+	}
+	return append(dirs, localSourceDirs(config)...)
+}
+
+// localSourceDirs returns the directories local directory sources are synced
+// from
+func localSourceDirs(config *Config) []string {
+	sources := []Source{config.Source()}
+	for _, dep := range config.Deps {
+		sources = append(sources, dep.Source)
+	}
+	var dirs []string
+	for _, source := range sources {
+		if source.Kind() != "path" {
+			continue
+		}
+		dir := config.ResolvePath(source.LocalPath)
+		if source.RemotePath != "" {
+			dir = filepath.Join(dir, strings.Trim(source.RemotePath, `"'`))
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// ClassifyChanges sorts changed paths reported by a Watcher into the import
+// paths of changed files in ProtoDir and the vendor directories, and whether
+// a local source changed, in which case a sync is needed to bring the change
+// into ProtoDir
+func ClassifyChanges(config *Config, paths []string) (imports []string, sourceChanged bool) {
+	within := func(dir, path string) (string, bool) {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", false
+		}
+		rel, err := filepath.Rel(abs, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return filepath.ToSlash(rel), true
+	}
+
+	for _, path := range paths {
+		synced := false
+		for _, dir := range syncedDirs(config) {
+			if rel, ok := within(dir.dir, path); ok {
+				imports = append(imports, rel)
+				synced = true
+				break
+			}
+		}
+		if synced {
+			continue
+		}
+		for _, dir := range localSourceDirs(config) {
+			if _, ok := within(dir, path); ok {
+				sourceChanged = true
+			}
+		}
+	}
+	return imports, sourceChanged
+}
+
+// AffectedFiles returns those of files, relative to ProtoDir, that are among
+// changed or import one of them directly or transitively. changed holds
+// import paths, which may name files in ProtoDir or in a vendor directory.
+func AffectedFiles(config *Config, files, changed []string) ([]string, error) {
+	all, err := findProtoFiles(config.ProtoPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	importers := map[string][]string{}
+	for _, file := range all {
+		data, err := os.ReadFile(filepath.Join(config.ProtoPath(), filepath.FromSlash(file)))
+		if err != nil {
+			continue
+		}
+		for _, imported := range ParseImports(data) {
+			importers[imported] = append(importers[imported], file)
+		}
+	}
+
+	affected := map[string]bool{}
+	queue := append([]string(nil), changed...)
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		if affected[file] {
+			continue
+		}
+		affected[file] = true
+		queue = append(queue, importers[file]...)
+	}
+
+	var result []string
+	for _, file := range files {
+		if affected[file] {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "notify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "proto-test-*")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tempDir)
+			writeFiles(t, tempDir, map[string]string{"proto/api/service.proto": "syntax = \"proto3\";\n"})
+			protoDir := filepath.Join(tempDir, "proto")
+			sourceDir := filepath.Join(tempDir, "source")
+
+			watcher, err := NewWatcher([]string{protoDir, sourceDir}, WatchOptions{Poll: poll, Debounce: 50 * time.Millisecond, Interval: 20 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("NewWatcher() error = %v", err)
+			}
+			defer watcher.Close()
+			if watcher.Polling() != poll {
+				t.Logf("Polling() = %v, filesystem notifications unavailable", watcher.Polling())
+			}
+
+			next := func() ([]string, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				return watcher.Next(ctx)
+			}
+
+			// Several quick edits are reported together once they settle
+			writeFiles(t, tempDir, map[string]string{"proto/api/service.proto": "syntax = \"proto2\";\n"})
+			writeFiles(t, tempDir, map[string]string{"proto/api/v2/user.proto": "syntax = \"proto3\";\n"})
+			want := []string{filepath.Join(protoDir, "api", "service.proto"), filepath.Join(protoDir, "api", "v2", "user.proto")}
+			changed, err := next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if !reflect.DeepEqual(changed, want) {
+				t.Errorf("Next() = %v, want %v", changed, want)
+			}
+
+			// Unchanged content, temporary files and other file types are not
+			// reported
+			writeFiles(t, tempDir, map[string]string{
+				"proto/api/service.proto": "syntax = \"proto2\";\n",
+				"proto/pb_tmp.proto":      "syntax = \"proto3\";\n",
+				"proto/README.md":         "notes\n",
+			})
+			if err := os.Remove(filepath.Join(protoDir, "pb_tmp.proto")); err != nil {
+				t.Fatalf("Failed to remove file: %v", err)
+			}
+			if changed, err := next(); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Next() after rewriting the same content = %v, %v, want no changes", changed, err)
+			}
+
+			// A directory created after watching started is picked up
+			writeFiles(t, tempDir, map[string]string{"source/common.proto": "syntax = \"proto3\";\n"})
+			if err := os.Remove(filepath.Join(protoDir, "api", "service.proto")); err != nil {
+				t.Fatalf("Failed to remove file: %v", err)
+			}
+			want = []string{filepath.Join(protoDir, "api", "service.proto"), filepath.Join(sourceDir, "common.proto")}
+			changed, err = next()
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			if !reflect.DeepEqual(changed, want) {
+				t.Errorf("Next() = %v, want %v", changed, want)
+			}
+		})
+	}
+}
+
+func TestAffectedFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "proto-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	enterDir(t, tempDir)
+
+	writeFiles(t, tempDir, map[string]string{
+		"proto/service.proto":                           "syntax = \"proto3\";\nimport \"common/types.proto\";\n",
+		"proto/admin.proto":                             "syntax = \"proto3\";\nimport \"service.proto\";\n",
+		"proto/health.proto":                            "syntax = \"proto3\";\nimport \"google/api/http.proto\";\n",
+		"proto/other.proto":                             "syntax = \"proto3\";\n",
+		"proto/common/types.proto":                      "syntax = \"proto3\";\n",
+		"local/common/types.proto":                      "syntax = \"proto3\";\n",
+		"proto_vendor/googleapis/google/api/http.proto": "syntax = \"proto3\";\n",
+	})
+	config := &Config{
+		LocalPath: "local",
+		ProtoDir:  "./proto",
+		Deps:      []Dependency{{Name: "googleapis", Source: Source{GitHubURL: "https://github.com/googleapis/googleapis"}}},
+		path:      filepath.Join(tempDir, ConfigFileName),
+	}
+	files := []string{"admin.proto", "health.proto", "other.proto", "service.proto"}
+
+	imports, sourceChanged := ClassifyChanges(config, []string{
+		filepath.Join(tempDir, "proto", "common", "types.proto"),
+		filepath.Join(tempDir, "proto_vendor", "googleapis", "google", "api", "http.proto"),
+	})
+	if want := []string{"common/types.proto", "google/api/http.proto"}; !reflect.DeepEqual(imports, want) || sourceChanged {
+		t.Errorf("ClassifyChanges() = %v, %v, want %v, false", imports, sourceChanged, want)
+	}
+	if _, sourceChanged := ClassifyChanges(config, []string{filepath.Join(tempDir, "local", "common", "types.proto")}); !sourceChanged {
+		t.Error("ClassifyChanges() for a local source file = false, want true")
+	}
+
+	tests := []struct {
+		changed []string
+		want    []string
+	}{
+		{[]string{"other.proto"}, []string{"other.proto"}},
+		{[]string{"common/types.proto"}, []string{"admin.proto", "service.proto"}},
+		{[]string{"google/api/http.proto"}, []string{"health.proto"}},
+		{[]string{"removed.proto"}, nil},
+	}
+	for _, tt := range tests {
+		affected, err := AffectedFiles(config, files, tt.changed)
+		if err != nil {
+			t.Fatalf("AffectedFiles(%v) error = %v", tt.changed, err)
+		}
+		if !reflect.DeepEqual(affected, tt.want) {
+			t.Errorf("AffectedFiles(%v) = %v, want %v", tt.changed, affected, tt.want)
+		}
+	}
+}